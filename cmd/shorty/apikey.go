@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+	"github.com/dabfleming/shorty/internal/passwords"
+)
+
+// apiKeyPrefix starts every API key, so they are easy to recognise
+const apiKeyPrefix = "shorty_"
+
+// runAPIKey implements the apikey subcommand:
+//
+//	shorty apikey create [-admin] <name> create a key, printing it once
+//	shorty apikey list                    list keys
+//	shorty apikey revoke <id>             revoke a key
+func runAPIKey(ds datastore.Datastore, args []string) error {
+	ctx := context.Background()
+
+	if len(args) == 0 {
+		return fmt.Errorf("missing apikey command, want create, list or revoke")
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		admin := fs.Bool("admin", false, "allow the key to see and change every link")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: shorty apikey create [-admin] <name>")
+		}
+
+		k, token, err := createAPIKey(ctx, ds, fs.Arg(0), *admin)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Created API key %d. It will not be shown again.\n", k.ID)
+		fmt.Println(token)
+		return nil
+
+	case "list":
+		keys, err := ds.GetAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tADMIN\tCREATED\tREVOKED")
+		for _, k := range keys {
+			revoked := "-"
+			if k.RevokedAt != nil {
+				revoked = k.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%v\t%s\t%s\n", k.ID, k.Name, k.Admin, k.CreatedAt.Format(time.RFC3339), revoked)
+		}
+		return tw.Flush()
+
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: shorty apikey revoke <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid API key id %q", args[1])
+		}
+		err = ds.RevokeAPIKey(ctx, id)
+		if err == datastore.ErrNotFound {
+			return fmt.Errorf("no active API key with id %d", id)
+		}
+		return err
+
+	default:
+		return fmt.Errorf("unknown apikey command %q, want create, list or revoke", args[0])
+	}
+}
+
+// createAPIKey saves a new API key, returning it along with the token to
+// give its user
+func createAPIKey(ctx context.Context, ds datastore.Datastore, name string, admin bool) (*datastore.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("API key name must not be empty")
+	}
+
+	token, hash, err := passwords.NewToken(apiKeyPrefix)
+	if err != nil {
+		return nil, "", err
+	}
+	k := &datastore.APIKey{Name: name, Hash: hash, Admin: admin}
+	if err := ds.SaveAPIKey(ctx, k); err != nil {
+		return nil, "", err
+	}
+	return k, token, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/dabfleming/shorty/internal/migrations"
+)
+
+// runMigrate implements the migrate subcommand:
+//
+//	shorty migrate [up]     apply all pending migrations
+//	shorty migrate down [n] roll back the n most recent migrations (default 1)
+//	shorty migrate status   list migrations and whether they are applied
+func runMigrate(db *sql.DB, dialect string, args []string) error {
+	ctx := context.Background()
+
+	cmd := "up"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	switch cmd {
+	case "up":
+		return migrateUp(ctx, db, dialect)
+
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			var err error
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+
+		m, err := migrations.New(db, dialect)
+		if err != nil {
+			return err
+		}
+		done, err := m.Down(ctx, n)
+		for _, v := range done {
+			log.Printf("Rolled back migration %04d", v)
+		}
+		return err
+
+	case "status":
+		m, err := migrations.New(db, dialect)
+		if err != nil {
+			return err
+		}
+		ss, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range ss {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%04d_%s\t%v\n", s.Version, s.Name, state)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, want up, down or status", cmd)
+	}
+}
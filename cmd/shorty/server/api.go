@@ -0,0 +1,380 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+)
+
+// apiPrefix is where version 1 of the JSON API is served
+const apiPrefix = "/api/v1/"
+
+// maxAPIBody limits the size of JSON request bodies
+const maxAPIBody = 1 << 16
+
+// apiLink is the JSON representation of a short url
+type apiLink struct {
+	Slug      string     `json:"slug"`
+	URL       string     `json:"url"`
+	ShortURL  string     `json:"short_url"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MaxClicks int        `json:"max_clicks,omitempty"`
+	Expired   bool       `json:"expired"`
+	Protected bool       `json:"password_protected"`
+	Visits    *int       `json:"visits,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+}
+
+// apiVisit is the JSON representation of a single visit
+type apiVisit struct {
+	Device  string    `json:"device"`
+	OS      string    `json:"os"`
+	Browser string    `json:"browser"`
+	IP      string    `json:"ip"`
+	Time    time.Time `json:"time"`
+}
+
+// apiError is the body of every API error response
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiHandler routes requests under /api/v1/:
+//
+//	GET    /api/v1/links               list a page of links with visit counts
+//	POST   /api/v1/links               create a link from {"url": ..., "slug": ...}
+//	GET    /api/v1/links/{slug}        fetch a link
+//	PUT    /api/v1/links/{slug}        change a link's destination with {"url": ...}
+//	DELETE /api/v1/links/{slug}        delete a link, keeping its visits unless ?purge=true
+//	GET    /api/v1/links/{slug}/visits fetch a link's visits, most recent first
+func (s *Server) apiHandler(w http.ResponseWriter, r *http.Request) {
+	if !acceptsJSON(r) {
+		s.apiError(w, http.StatusNotAcceptable, "not_acceptable", "This API only produces application/json.")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, apiPrefix), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "links":
+		switch r.Method {
+		case "GET":
+			s.apiListLinks(w, r)
+		case "POST":
+			s.apiCreateLink(w, r)
+		default:
+			s.apiMethodNotAllowed(w, "GET, POST")
+		}
+	case len(parts) == 2 && parts[0] == "links" && parts[1] != "":
+		switch r.Method {
+		case "GET":
+			s.apiGetLink(w, r, parts[1])
+		case "PUT":
+			s.apiUpdateLink(w, r, parts[1])
+		case "DELETE":
+			s.apiDeleteLink(w, r, parts[1])
+		default:
+			s.apiMethodNotAllowed(w, "GET, PUT, DELETE")
+		}
+	case len(parts) == 3 && parts[0] == "links" && parts[1] != "" && parts[2] == "visits" && s.cfg.Features.Stats:
+		if r.Method != "GET" {
+			s.apiMethodNotAllowed(w, "GET")
+			return
+		}
+		s.apiGetVisits(w, r, parts[1])
+	default:
+		s.apiError(w, http.StatusNotFound, "not_found", "No such API endpoint.")
+	}
+}
+
+// apiListLinks lists a page of links with their visit counts, filtered
+// and sorted by the query parameters described at listLinks
+func (s *Server) apiListLinks(w http.ResponseWriter, r *http.Request) {
+	vs, next, err := s.listLinks(r.Context(), r.URL.Query())
+	if re, ok := err.(*requestError); ok {
+		s.apiError(w, re.Status, re.Code, re.Message)
+		return
+	}
+	if err != nil {
+		s.apiInternalError(w, "Error getting visitor counts", err)
+		return
+	}
+
+	links := make([]apiLink, 0, len(vs))
+	for _, v := range vs {
+		count := v.Count
+		u := datastore.URLMap{ExpiresAt: v.ExpiresAt, MaxClicks: v.MaxClicks, Clicks: v.Count}
+		links = append(links, apiLink{
+			Slug:      v.Slug,
+			URL:       v.URL,
+			ShortURL:  shortURL(r, v.Slug),
+			ExpiresAt: v.ExpiresAt,
+			MaxClicks: v.MaxClicks,
+			Expired:   u.Expired(time.Now()),
+			Protected: v.Protected,
+			Visits:    &count,
+			CreatedAt: v.CreatedAt,
+			Tags:      v.Tags,
+		})
+	}
+	resp := struct {
+		Links      []apiLink `json:"links"`
+		NextCursor string    `json:"next_cursor,omitempty"`
+	}{Links: links}
+	if next != nil {
+		resp.NextCursor = next.Encode()
+	}
+	s.apiRespond(w, http.StatusOK, resp)
+}
+
+// apiCreateLink creates a new link
+func (s *Server) apiCreateLink(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL       string     `json:"url"`
+		Slug      string     `json:"slug"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		MaxClicks int        `json:"max_clicks"`
+		Password  string     `json:"password"`
+		Tags      []string   `json:"tags"`
+		// Force a new link even if one to the same url exists
+		Force bool `json:"force"`
+	}
+	if !s.apiDecode(w, r, &req) {
+		return
+	}
+
+	u := &datastore.URLMap{
+		URL:       req.URL,
+		Slug:      req.Slug,
+		ExpiresAt: req.ExpiresAt,
+		MaxClicks: req.MaxClicks,
+		Tags:      req.Tags,
+	}
+	existing, err := s.createLink(r.Context(), u, req.Password, req.Force)
+	if re, ok := err.(*requestError); ok {
+		s.apiError(w, re.Status, re.Code, re.Message)
+		return
+	}
+	if err != nil {
+		s.apiInternalError(w, "Error saving new short url", err)
+		return
+	}
+
+	status := http.StatusCreated
+	if existing {
+		status = http.StatusOK
+	}
+	w.Header().Set("Location", apiPrefix+"links/"+u.Slug)
+	s.apiRespond(w, status, s.apiLinkFor(r, u))
+}
+
+// apiGetLink fetches a single link
+func (s *Server) apiGetLink(w http.ResponseWriter, r *http.Request, slug string) {
+	url, err := s.ds.GetURL(r.Context(), slug, s.scope(r.Context(), datastore.RoleViewer))
+	if err == datastore.ErrNotFound {
+		s.apiError(w, http.StatusNotFound, "not_found", fmt.Sprintf("The short url '%v' does not exist.", slug))
+		return
+	}
+	if err != nil {
+		s.apiInternalError(w, "Error looking up url", err)
+		return
+	}
+
+	s.apiRespond(w, http.StatusOK, s.apiLinkFor(r, url))
+}
+
+// apiUpdateLink changes where a link points
+func (s *Server) apiUpdateLink(w http.ResponseWriter, r *http.Request, slug string) {
+	var req struct {
+		URL string `json:"url"`
+	}
+	if !s.apiDecode(w, r, &req) {
+		return
+	}
+
+	err := s.updateLink(r.Context(), slug, req.URL)
+	if re, ok := err.(*requestError); ok {
+		s.apiError(w, re.Status, re.Code, re.Message)
+		return
+	}
+	if err != nil {
+		s.apiInternalError(w, "Error updating short url", err)
+		return
+	}
+
+	s.apiGetLink(w, r, slug)
+}
+
+// apiDeleteLink deletes a link. Its visits are kept unless purge=true.
+func (s *Server) apiDeleteLink(w http.ResponseWriter, r *http.Request, slug string) {
+	purge := false
+	if p := r.URL.Query().Get("purge"); p != "" {
+		var err error
+		purge, err = strconv.ParseBool(p)
+		if err != nil {
+			s.apiError(w, http.StatusBadRequest, "invalid_purge", "purge must be true or false.")
+			return
+		}
+	}
+
+	err := s.deleteLink(r.Context(), slug, purge)
+	if re, ok := err.(*requestError); ok {
+		s.apiError(w, re.Status, re.Code, re.Message)
+		return
+	}
+	if err != nil {
+		s.apiInternalError(w, "Error deleting short url", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiGetVisits fetches a link along with its visits
+func (s *Server) apiGetVisits(w http.ResponseWriter, r *http.Request, slug string) {
+	url, visits, err := s.ds.GetVisits(r.Context(), slug, s.scope(r.Context(), datastore.RoleViewer))
+	if err == datastore.ErrNotFound {
+		s.apiError(w, http.StatusNotFound, "not_found", fmt.Sprintf("The short url '%v' does not exist.", slug))
+		return
+	}
+	if err != nil {
+		s.apiInternalError(w, "Error getting visits", err)
+		return
+	}
+
+	vs := make([]apiVisit, 0, len(visits))
+	for _, v := range visits {
+		vs = append(vs, apiVisit{
+			Device:  v.Device,
+			OS:      v.OS,
+			Browser: v.Browser,
+			IP:      v.IP,
+			Time:    v.Time,
+		})
+	}
+	link := s.apiLinkFor(r, url)
+	count := len(vs)
+	link.Visits = &count
+	s.apiRespond(w, http.StatusOK, struct {
+		Link   apiLink    `json:"link"`
+		Visits []apiVisit `json:"visits"`
+	}{
+		Link:   link,
+		Visits: vs,
+	})
+}
+
+// apiLinkFor converts a stored url to its API representation
+func (s *Server) apiLinkFor(r *http.Request, u *datastore.URLMap) apiLink {
+	link := apiLink{
+		Slug:      u.Slug,
+		URL:       u.URL,
+		ShortURL:  shortURL(r, u.Slug),
+		ExpiresAt: u.ExpiresAt,
+		MaxClicks: u.MaxClicks,
+		Expired:   u.Expired(time.Now()),
+		Protected: u.PasswordHash != "",
+		Tags:      u.Tags,
+	}
+	if !u.CreatedAt.IsZero() {
+		link.CreatedAt = &u.CreatedAt
+	}
+	return link
+}
+
+// apiDecode reads a JSON request body into v. If it can't, it writes an
+// error response and returns false.
+func (s *Server) apiDecode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mt != "application/json" {
+		s.apiError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "Request body must be application/json.")
+		return false
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		s.apiError(w, http.StatusBadRequest, "invalid_json", fmt.Sprintf("Could not parse request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// apiRespond writes v as the JSON response body
+func (s *Server) apiRespond(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing API response: %v", err)
+	}
+}
+
+// apiError writes an error response in the API's standard shape
+func (s *Server) apiError(w http.ResponseWriter, status int, code, message string) {
+	s.apiRespond(w, status, apiError{apiErrorDetail{Code: code, Message: message}})
+}
+
+// apiInternalError logs err and writes a generic 500 response
+func (s *Server) apiInternalError(w http.ResponseWriter, msg string, err error) {
+	log.Printf("%v: %v", msg, err)
+	switch status := errorStatus(err); status {
+	case http.StatusGatewayTimeout:
+		s.apiError(w, status, "timeout", "The database took too long to respond, please try again.")
+	case http.StatusServiceUnavailable:
+		s.apiError(w, status, "unavailable", "The database is unavailable, please try again.")
+	default:
+		s.apiError(w, status, "internal", "Internal server error.")
+	}
+}
+
+func (s *Server) apiMethodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	s.apiError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed.")
+}
+
+// acceptsJSON reports whether the request's Accept header allows a JSON
+// response. A missing header accepts anything.
+func acceptsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return true
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(q, 64); err == nil && f == 0 {
+				continue
+			}
+		}
+		switch mt {
+		case "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+	return false
+}
+
+// shortURL returns the absolute short url for slug, as seen by the client
+func shortURL(r *http.Request, slug string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/" + slug
+}
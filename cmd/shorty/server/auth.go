@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+	"github.com/dabfleming/shorty/internal/passwords"
+)
+
+type contextKey int
+
+const (
+	apiKeyContextKey contextKey = iota
+	userContextKey
+	workspacesContextKey
+)
+
+// authMiddleware requires requests to carry a valid API key or, outside the
+// JSON API, a signed in user's session cookie. The caller is then available
+// to handlers through apiKeyFrom or userFrom. It does nothing if
+// authentication is turned off.
+func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.cfg.Features.Auth {
+			next(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		if token := apiKeyToken(r); token != "" {
+			k, err := s.ds.GetAPIKeyByHash(ctx, passwords.HashToken(token))
+			if err == datastore.ErrNotFound || (err == nil && k.RevokedAt != nil) {
+				s.unauthorized(w, r, "Invalid API key.")
+				return
+			}
+			if err != nil {
+				log.Printf("Error looking up API key: %v", err)
+				w.WriteHeader(errorStatus(err))
+				return
+			}
+			ctx = context.WithValue(ctx, apiKeyContextKey, k)
+		} else {
+			// The API doesn't accept session cookies, so other sites can't
+			// make requests to it on a signed in user's behalf
+			u, err := s.sessionUser(r)
+			if err != nil {
+				log.Printf("Error looking up session: %v", err)
+				w.WriteHeader(errorStatus(err))
+				return
+			}
+			if u == nil || isAPI(r) {
+				s.unauthorized(w, r, "An API key is required.")
+				return
+			}
+			ms, err := s.ds.GetWorkspaces(ctx, u.ID)
+			if err != nil {
+				log.Printf("Error looking up workspaces: %v", err)
+				w.WriteHeader(errorStatus(err))
+				return
+			}
+			ctx = context.WithValue(ctx, userContextKey, u)
+			ctx = context.WithValue(ctx, workspacesContextKey, ms)
+		}
+
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// apiKeyToken finds the API key in a request. It may be sent as a bearer
+// token, as the password for basic auth, or in an X-API-Key header.
+func apiKeyToken(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// unauthorized rejects a request that isn't signed in. Browsers are sent to
+// the login page.
+func (s *Server) unauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	if isAPI(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="shorty"`)
+		s.apiError(w, http.StatusUnauthorized, "unauthorized", msg)
+		return
+	}
+
+	if apiKeyToken(r) != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, msg)
+		return
+	}
+
+	// Only GETs can be safely repeated after logging in
+	next := "/"
+	if r.Method == "GET" {
+		next = r.URL.RequestURI()
+	}
+	http.Redirect(w, r, "/login?next="+url.QueryEscape(next), http.StatusSeeOther)
+}
+
+// isAPI reports whether the request is for the JSON API
+func isAPI(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, apiPrefix)
+}
+
+// apiKeyFrom returns the API key the request was authenticated with, or nil
+func apiKeyFrom(ctx context.Context) *datastore.APIKey {
+	k, _ := ctx.Value(apiKeyContextKey).(*datastore.APIKey)
+	return k
+}
+
+// userFrom returns the signed in user making the request, or nil
+func userFrom(ctx context.Context) *datastore.User {
+	u, _ := ctx.Value(userContextKey).(*datastore.User)
+	return u
+}
+
+// workspacesFrom returns the workspaces the signed in user belongs to
+func workspacesFrom(ctx context.Context) []datastore.Membership {
+	ms, _ := ctx.Value(workspacesContextKey).([]datastore.Membership)
+	return ms
+}
+
+// roleIn returns the signed in user's role in a workspace, or "" if they
+// aren't a member
+func roleIn(ctx context.Context, workspaceID int) datastore.Role {
+	for _, m := range workspacesFrom(ctx) {
+		if m.ID == workspaceID {
+			return m.Role
+		}
+	}
+	return ""
+}
+
+// scope returns the urls the caller may act on with the given role: every
+// url for an admin key or when authentication is off, otherwise those the
+// key or user owns, and for users those in workspaces where they have the
+// role
+func (s *Server) scope(ctx context.Context, need datastore.Role) datastore.Scope {
+	if !s.cfg.Features.Auth {
+		return datastore.AllURLs
+	}
+	if k := apiKeyFrom(ctx); k != nil {
+		return k.Scope()
+	}
+	if u := userFrom(ctx); u != nil {
+		return u.Scope(workspacesFrom(ctx), need)
+	}
+	return datastore.Scope{}
+}
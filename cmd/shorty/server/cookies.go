@@ -0,0 +1,39 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// sign returns value with an HMAC appended, so it can be handed to the
+// client and trusted when it comes back. extra is covered by the HMAC but
+// not included in the result, which binds the value to some server side
+// state without revealing it.
+func (s *Server) sign(value string, extra ...string) string {
+	return value + "." + s.mac(value, extra...)
+}
+
+// verify checks a string produced by sign, returning the original value
+func (s *Server) verify(signed string, extra ...string) (string, bool) {
+	i := strings.LastIndex(signed, ".")
+	if i < 0 {
+		return "", false
+	}
+	value, mac := signed[:i], signed[i+1:]
+	if !hmac.Equal([]byte(mac), []byte(s.mac(value, extra...))) {
+		return "", false
+	}
+	return value, true
+}
+
+func (s *Server) mac(value string, extra ...string) string {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(value))
+	for _, e := range extra {
+		h.Write([]byte{0})
+		h.Write([]byte(e))
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
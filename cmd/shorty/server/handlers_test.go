@@ -0,0 +1,414 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dabfleming/shorty/internal/config"
+	"github.com/dabfleming/shorty/internal/datastore"
+)
+
+// do sends a request through the server's routes. A body is sent as JSON
+// for paths under the API, and as a form otherwise.
+func do(s *Server, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		if strings.HasPrefix(path, apiPrefix) {
+			r.Header.Set("Content-Type", "application/json")
+		} else {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, r)
+	return w
+}
+
+// decode parses a JSON response body into v
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+// errorCode returns the code of an API error response
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var e apiError
+	decode(t, w, &e)
+	return e.Error.Code
+}
+
+func TestAPICreateAndForward(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	w := do(s, "POST", "/api/v1/links", `{"url": "https://Example.com", "slug": "ex"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s, want 201", w.Code, w.Body)
+	}
+	var link apiLink
+	decode(t, w, &link)
+	if link.Slug != "ex" || link.URL != "https://example.com/" {
+		t.Errorf("created %+v, want ex to the normalized url", link)
+	}
+
+	w = do(s, "GET", "/ex", "")
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "https://example.com/" {
+		t.Errorf("forward = %d to %q, want 307 to https://example.com/", w.Code, w.Header().Get("Location"))
+	}
+
+	if w := do(s, "GET", "/nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("forward of a missing slug = %d, want 404", w.Code)
+	}
+}
+
+func TestAPISlugTaken(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	if w := do(s, "POST", "/api/v1/links", `{"url": "https://one.example/", "slug": "dup"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", w.Code, w.Body)
+	}
+	w := do(s, "POST", "/api/v1/links", `{"url": "https://two.example/", "slug": "dup"}`)
+	if w.Code != http.StatusConflict || errorCode(t, w) != "slug_taken" {
+		t.Errorf("create with a taken slug = %d %s, want 409 slug_taken", w.Code, w.Body)
+	}
+
+	// The original is untouched
+	w = do(s, "GET", "/dup", "")
+	if loc := w.Header().Get("Location"); loc != "https://one.example/" {
+		t.Errorf("dup forwards to %q, want the first url", loc)
+	}
+
+	// So is the form
+	form := url.Values{"url": {"https://three.example/"}, "slug": {"dup"}}.Encode()
+	if w := do(s, "POST", "/new", form); w.Code != http.StatusConflict {
+		t.Errorf("form create with a taken slug = %d, want 409", w.Code)
+	}
+}
+
+func TestVisitsRecorded(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	if w := do(s, "POST", "/api/v1/links", `{"url": "https://example.com/", "slug": "vv"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", w.Code, w.Body)
+	}
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("GET", "/vv", nil)
+		r.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 11_0 like Mac OS X) AppleWebKit/604.1.38 (KHTML, like Gecko) Version/11.0 Mobile/15A372 Safari/604.1")
+		s.mux.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	// Visits are saved in the background; closing saves the queue
+	if err := s.hits.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	w := do(s, "GET", "/api/v1/links/vv/visits", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("visits = %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Link   apiLink    `json:"link"`
+		Visits []apiVisit `json:"visits"`
+	}
+	decode(t, w, &resp)
+	if len(resp.Visits) != 3 || resp.Link.Visits == nil || *resp.Link.Visits != 3 {
+		t.Fatalf("got %d visits, want 3: %s", len(resp.Visits), w.Body)
+	}
+	if v := resp.Visits[0]; v.Device != "iPhone" || v.OS != "iOS" {
+		t.Errorf("visit = %+v, want an iPhone on iOS", v)
+	}
+
+	w = do(s, "GET", "/api/v1/links", "")
+	var list struct {
+		Links []apiLink `json:"links"`
+	}
+	decode(t, w, &list)
+	if len(list.Links) != 1 || list.Links[0].Visits == nil || *list.Links[0].Visits != 3 {
+		t.Errorf("list = %s, want vv with 3 visits", w.Body)
+	}
+
+	if w := do(s, "GET", "/info/vv", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "iPhone") {
+		t.Errorf("info page = %d, want it to list the visits", w.Code)
+	}
+}
+
+func TestAPIConcurrentCreate(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	const workers = 20
+	codes := make([]int, workers)
+	slugs := make([]string, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := do(s, "POST", "/api/v1/links", fmt.Sprintf(`{"url": "https://example.com/%d"}`, i))
+			codes[i] = w.Code
+			var link apiLink
+			json.Unmarshal(w.Body.Bytes(), &link)
+			slugs[i] = link.Slug
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i := range codes {
+		if codes[i] != http.StatusCreated {
+			t.Errorf("create %d = %d", i, codes[i])
+			continue
+		}
+		if seen[slugs[i]] {
+			t.Errorf("slug %q was given out twice", slugs[i])
+		}
+		seen[slugs[i]] = true
+	}
+}
+
+func TestAPIDedupe(t *testing.T) {
+	for _, strategy := range []string{"random", "sequential"} {
+		t.Run(strategy, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *config.Config) {
+				cfg.DedupeURLs = true
+				cfg.SlugStrategy = strategy
+				cfg.SlugKey = "a secret key"
+			})
+
+			create := func(body string) (int, string) {
+				w := do(s, "POST", "/api/v1/links", body)
+				var link apiLink
+				json.Unmarshal(w.Body.Bytes(), &link)
+				return w.Code, link.Slug
+			}
+
+			code, first := create(`{"url": "https://example.com/"}`)
+			if code != http.StatusCreated {
+				t.Fatalf("create = %d", code)
+			}
+			if code, slug := create(`{"url": "https://EXAMPLE.com"}`); code != http.StatusOK || slug != first {
+				t.Errorf("create of the same url = %d %q, want 200 %q", code, slug, first)
+			}
+			if code, slug := create(`{"url": "https://example.com/", "force": true}`); code != http.StatusCreated || slug == first {
+				t.Errorf("forced create = %d %q, want 201 with a new slug", code, slug)
+			}
+
+			// Racing creates share one link
+			const workers = 10
+			slugs := make([]string, workers)
+			var wg sync.WaitGroup
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, slugs[i] = create(`{"url": "https://race.example/"}`)
+				}(i)
+			}
+			wg.Wait()
+			for i := range slugs {
+				if slugs[i] == "" || slugs[i] != slugs[0] {
+					t.Errorf("racing creates got %q and %q", slugs[0], slugs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSequentialSlugReserved(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.SlugStrategy = "sequential"
+		cfg.SlugKey = "a secret key"
+	})
+
+	// Slugs for ids not yet used are refused, so they stay free
+	future := s.ids.Encode(100)
+	w := do(s, "POST", "/api/v1/links", fmt.Sprintf(`{"url": "https://example.com/", "slug": %q}`, future))
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != "slug_reserved" {
+		t.Errorf("requesting %q = %d %s, want 400 slug_reserved", future, w.Code, w.Body)
+	}
+
+	// Those Encode can't produce are allowed
+	custom := "zz-custom"
+	if _, ok := s.ids.Decode(custom); ok {
+		t.Fatalf("%q decodes", custom)
+	}
+	if w := do(s, "POST", "/api/v1/links", fmt.Sprintf(`{"url": "https://example.com/", "slug": %q}`, custom)); w.Code != http.StatusCreated {
+		t.Errorf("requesting %q = %d %s, want 201", custom, w.Code, w.Body)
+	}
+
+	// Every generated slug is one a request would have been refused
+	for i := 0; i < 20; i++ {
+		w := do(s, "POST", "/api/v1/links", fmt.Sprintf(`{"url": "https://example.com/%d"}`, i))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create = %d %s", w.Code, w.Body)
+		}
+		var link apiLink
+		decode(t, w, &link)
+		if id, ok := s.ids.Decode(link.Slug); !ok || s.ids.Encode(id) != link.Slug {
+			t.Errorf("generated slug %q isn't reserved", link.Slug)
+		}
+	}
+}
+
+func TestListOwner(t *testing.T) {
+	s := newTestServer(t, nil)
+	ctx := context.Background()
+
+	alice := &datastore.User{Username: "alice"}
+	if err := s.ds.SaveUser(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*datastore.URLMap{
+		{Slug: "mine", URL: "https://example.com/", UserID: alice.ID},
+		{Slug: "other", URL: "https://example.com/"},
+	} {
+		if err := s.ds.SaveNewURL(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Usernames are matched however they're written, as when logging in
+	for _, owner := range []string{"user:alice", "user:Alice", "user:%20ALICE%20"} {
+		w := do(s, "GET", "/api/v1/links?owner="+owner, "")
+		var list struct {
+			Links []apiLink `json:"links"`
+		}
+		decode(t, w, &list)
+		if len(list.Links) != 1 || list.Links[0].Slug != "mine" {
+			t.Errorf("owner=%v lists %s, want mine", owner, w.Body)
+		}
+	}
+
+	w := do(s, "GET", "/api/v1/links?owner=user:nobody", "")
+	if !strings.Contains(w.Body.String(), `"links":[]`) {
+		t.Errorf("owner=user:nobody lists %s, want nothing", w.Body)
+	}
+	if w := do(s, "GET", "/api/v1/links?owner=team:1", ""); w.Code != http.StatusBadRequest || errorCode(t, w) != "invalid_owner" {
+		t.Errorf("owner=team:1 = %d %s, want 400 invalid_owner", w.Code, w.Body)
+	}
+}
+
+func TestUnlockCaseInsensitive(t *testing.T) {
+	cfg := config.Default()
+	cfg.Datastore = "memory"
+	cfg.Features.Auth = false
+	cfg.CaseInsensitiveSlugs = true
+	srv, err := New(&cfg, datastore.FoldCase(datastore.NewMemory()), testParser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &srv
+	defer s.hits.Close(context.Background())
+
+	if w := do(s, "POST", "/api/v1/links", `{"url": "https://example.com/", "slug": "locked", "password": "secret"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", w.Code, w.Body)
+	}
+
+	// The form posts back to, and the cookie is scoped to, the path the
+	// visitor used rather than the folded slug
+	w := do(s, "GET", "/LOCKED", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `action="/LOCKED"`) {
+		t.Fatalf("unlock form = %d %s, want it to post to /LOCKED", w.Code, w.Body)
+	}
+	w = do(s, "POST", "/LOCKED", url.Values{"password": {"secret"}}.Encode())
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("unlock = %d %s, want 303", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Path != "/LOCKED" {
+		t.Fatalf("unlock set cookies %v, want one for /LOCKED", cookies)
+	}
+
+	r := httptest.NewRequest("GET", "/LOCKED", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	s.mux.ServeHTTP(w, r)
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "https://example.com/" {
+		t.Errorf("visit with the cookie = %d to %q, want 307 to https://example.com/", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestHTMLEscaped(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	const script = "<script>alert(1)</script>"
+	form := func(v url.Values) string { return v.Encode() }
+	steps := []struct {
+		name, path, body string
+	}{
+		{"create with a bad slug", "/new", form(url.Values{"url": {"https://example.com/"}, "slug": {script}})},
+		{"create", "/new", form(url.Values{"url": {"https://example.com/?q=" + script}, "slug": {"xss"}})},
+		{"edit", "/edit", form(url.Values{"url": {"https://example.com/?q=" + script + "2"}, "slug": {"xss"}})},
+		{"edit a missing slug", "/edit", form(url.Values{"url": {"https://example.com/"}, "slug": {script}})},
+		{"info", "/info/xss", ""},
+		{"delete a missing slug", "/delete", form(url.Values{"slug": {script}})},
+	}
+	for _, st := range steps {
+		method := "POST"
+		if st.body == "" {
+			method = "GET"
+		}
+		w := do(s, method, st.path, st.body)
+		if strings.Contains(w.Body.String(), "<script>") {
+			t.Errorf("%v: response has an unescaped script: %s", st.name, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), "&lt;") {
+			t.Errorf("%v: response %d %s doesn't show the script escaped", st.name, w.Code, w.Body)
+		}
+	}
+}
+
+func TestExpiredBeforePassword(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	if w := do(s, "POST", "/api/v1/links", `{"url": "https://example.com/", "slug": "once", "password": "secret", "max_clicks": 1}`); w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", w.Code, w.Body)
+	}
+	if w := do(s, "POST", "/once", url.Values{"password": {"secret"}}.Encode()); w.Code != http.StatusSeeOther {
+		t.Fatalf("unlock = %d %s, want 303", w.Code, w.Body)
+	}
+
+	// Used up, so there's no password to ask for or check
+	if w := do(s, "GET", "/once", ""); w.Code != http.StatusGone {
+		t.Errorf("visit after the last click = %d %s, want 410", w.Code, w.Body)
+	}
+	if w := do(s, "POST", "/once", url.Values{"password": {"wrong"}}.Encode()); w.Code != http.StatusGone {
+		t.Errorf("password after the last click = %d %s, want 410", w.Code, w.Body)
+	}
+}
+
+func TestListProtected(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	for _, body := range []string{
+		`{"url": "https://example.com/1", "slug": "locked", "password": "secret"}`,
+		`{"url": "https://example.com/2", "slug": "open"}`,
+	} {
+		if w := do(s, "POST", "/api/v1/links", body); w.Code != http.StatusCreated {
+			t.Fatalf("create = %d %s", w.Code, w.Body)
+		}
+	}
+
+	// The listing agrees with each link's own page
+	var list struct {
+		Links []apiLink `json:"links"`
+	}
+	decode(t, do(s, "GET", "/api/v1/links", ""), &list)
+	if len(list.Links) != 2 {
+		t.Fatalf("listed %+v, want 2 links", list.Links)
+	}
+	for _, listed := range list.Links {
+		var link apiLink
+		decode(t, do(s, "GET", "/api/v1/links/"+listed.Slug, ""), &link)
+		if listed.Protected != link.Protected || link.Protected != (link.Slug == "locked") {
+			t.Errorf("%v listed as protected %v, got as %v", listed.Slug, listed.Protected, link.Protected)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+	"github.com/dabfleming/shorty/internal/passwords"
+	"github.com/dabfleming/shorty/internal/slugs"
+	"github.com/dabfleming/shorty/internal/urls"
+)
+
+// maxIDAttempts bounds how many ids are tried when saving a url with a
+// sequential slug
+const maxIDAttempts = 5
+
+// requestError is a problem with a request that should be reported back to
+// the client, rather than logged as a server error
+type requestError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *requestError) Error() string {
+	return e.Message
+}
+
+// createLink validates and saves a new short url, generating a slug if none
+// was requested, in which case u.Slug is set to the one used. If password is
+// not empty it will be needed to follow the link. Problems with the input
+// are returned as a *requestError.
+//
+// If urls are deduplicated and the owner already has a plain link to the
+// same destination, u is set to that link and existing is true, unless
+// force asks for a new one.
+func (s *Server) createLink(ctx context.Context, u *datastore.URLMap, password string, force bool) (existing bool, err error) {
+	dest, err := s.checkURL(ctx, u.URL)
+	if err != nil {
+		return false, err
+	}
+	u.URL = dest
+
+	// Checks on limits
+	if u.ExpiresAt != nil && !u.ExpiresAt.After(time.Now()) {
+		return false, &requestError{http.StatusBadRequest, "invalid_expiry", "Expiry time must be in the future."}
+	}
+	if u.MaxClicks < 0 {
+		return false, &requestError{http.StatusBadRequest, "invalid_max_clicks", "Max clicks must not be negative."}
+	}
+	if u.Tags, err = parseTags(u.Tags); err != nil {
+		return false, err
+	}
+
+	// The API key or user creating the url owns it
+	if k := apiKeyFrom(ctx); k != nil {
+		u.APIKeyID = k.ID
+	}
+	if user := userFrom(ctx); user != nil {
+		u.UserID = user.ID
+	}
+	if u.WorkspaceID != 0 && !roleIn(ctx, u.WorkspaceID).Includes(datastore.RoleEditor) {
+		return false, &requestError{http.StatusForbidden, "forbidden", "You can't create links in that workspace."}
+	}
+
+	if password != "" {
+		hash, err := passwords.Hash(password)
+		if err != nil {
+			return false, err
+		}
+		u.PasswordHash = hash
+	}
+
+	// Reuse the owner's plain link to the same destination, unless a new
+	// one was asked for. The datastore only does so for links without
+	// limits, a password or tags.
+	u.Dedupe = s.cfg.DedupeURLs && !force && u.Slug == ""
+
+	// Check for requested slug
+	if u.Slug != "" && !s.cfg.Features.CustomSlugs {
+		return false, &requestError{http.StatusBadRequest, "invalid_slug", "Requesting a short url is not allowed."}
+	}
+	if u.Slug != "" && s.cfg.CaseInsensitiveSlugs {
+		// The datastore folds it anyway, but the checks below should see
+		// the slug that will actually be used
+		u.Slug = datastore.FoldSlug(u.Slug)
+	}
+	if u.Slug != "" {
+		if err := s.validator.Validate(u.Slug); err != nil {
+			code := "invalid_slug"
+			switch err.(*slugs.Rejection).Reason {
+			case slugs.Reserved:
+				code = "slug_reserved"
+			case slugs.Blocked:
+				code = "slug_blocked"
+			}
+			return false, &requestError{http.StatusBadRequest, code, err.Error()}
+		}
+	}
+	if u.Slug != "" && s.ids != nil {
+		// Keep slugs that may be generated in future free
+		if _, ok := s.ids.Decode(u.Slug); ok {
+			return false, &requestError{http.StatusBadRequest, "slug_reserved", fmt.Sprintf("The short url '%v' is reserved for generated links.", u.Slug)}
+		}
+	}
+	if u.Slug == "" && s.ids != nil {
+		// Derive the slug from the url's id. Existing custom slugs could
+		// still clash, in which case a new id is tried.
+		slugFor := func(id int) string {
+			slug := s.ids.Encode(id)
+			if !s.validator.Usable(slug) {
+				return ""
+			}
+			return slug
+		}
+		for i := 0; i < maxIDAttempts; i++ {
+			err := s.ds.SaveNewURLFromID(ctx, u, slugFor)
+			if err == datastore.ErrURLExists {
+				return true, nil
+			}
+			if err != datastore.ErrSlugTaken {
+				return false, err
+			}
+		}
+		return false, &requestError{http.StatusServiceUnavailable, "slugs_exhausted", "Could not find a free short url, please try again."}
+	}
+	if u.Slug == "" {
+		// Generate a random slug, trying again if it's taken
+		_, err := s.slugs.Generate(s.validator.Usable, func(slug string) (bool, error) {
+			u.Slug = slug
+			err := s.ds.SaveNewURL(ctx, u)
+			if err == datastore.ErrSlugTaken {
+				return true, nil
+			}
+			return false, err
+		})
+		if err == datastore.ErrURLExists {
+			return true, nil
+		}
+		if err == slugs.ErrExhausted {
+			log.Printf("No free slug found for a new url, the last tried was %v", u.Slug)
+			return false, &requestError{http.StatusServiceUnavailable, "slugs_exhausted", "Could not find a free short url, please try again."}
+		}
+		return false, err
+	}
+
+	// Request to save to DB
+	err = s.ds.SaveNewURL(ctx, u)
+	if err == datastore.ErrSlugTaken {
+		// Duplicate slug
+		return false, &requestError{http.StatusConflict, "slug_taken", fmt.Sprintf("Error, the short url '%v' is already in use.", u.Slug)}
+	}
+	return false, err
+}
+
+// updateLink points an existing short url at a new destination
+func (s *Server) updateLink(ctx context.Context, slug, url string) error {
+	url, err := s.checkURL(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	err = s.ds.UpdateURL(ctx, slug, url, s.scope(ctx, datastore.RoleEditor))
+	if err == datastore.ErrNotFound {
+		return s.notFound(ctx, slug)
+	}
+	return err
+}
+
+// deleteLink removes a short url, keeping or purging its visit history
+func (s *Server) deleteLink(ctx context.Context, slug string, purge bool) error {
+	mode := datastore.KeepVisits
+	if purge {
+		mode = datastore.PurgeVisits
+	}
+
+	err := s.ds.DeleteURL(ctx, slug, mode, s.scope(ctx, datastore.RoleEditor))
+	if err == datastore.ErrNotFound {
+		return s.notFound(ctx, slug)
+	}
+	return err
+}
+
+// notFound explains why a url couldn't be changed: either it doesn't exist
+// as far as the caller can tell, or they can see it but only as a viewer
+func (s *Server) notFound(ctx context.Context, slug string) error {
+	_, err := s.ds.GetURL(ctx, slug, s.scope(ctx, datastore.RoleViewer))
+	if err == nil {
+		return &requestError{http.StatusForbidden, "forbidden", fmt.Sprintf("You don't have permission to change '%v'.", slug)}
+	}
+	if err != nil && err != datastore.ErrNotFound {
+		return err
+	}
+	return &requestError{http.StatusNotFound, "not_found", fmt.Sprintf("The short url '%v' does not exist.", slug)}
+}
+
+// parseLimits parses the optional expiry fields from the new link form: a
+// duration until expiry like "24h", and a maximum number of clicks
+func parseLimits(expiresIn, maxClicks string) (*time.Time, int, error) {
+	var expiresAt *time.Time
+	if expiresIn != "" {
+		d, err := time.ParseDuration(expiresIn)
+		if err != nil || d <= 0 {
+			return nil, 0, &requestError{http.StatusBadRequest, "invalid_expiry", "Expiry must be a positive duration, like 24h or 30m."}
+		}
+		t := time.Now().Add(d).Truncate(time.Second)
+		expiresAt = &t
+	}
+
+	n := 0
+	if maxClicks != "" {
+		var err error
+		n, err = strconv.Atoi(maxClicks)
+		if err != nil || n < 0 {
+			return nil, 0, &requestError{http.StatusBadRequest, "invalid_max_clicks", "Max clicks must be a whole number."}
+		}
+	}
+
+	return expiresAt, n, nil
+}
+
+// errorStatus is the status to respond with for an unexpected error: 504
+// or 503 if the datastore timed out or couldn't be reached, else 500
+func errorStatus(err error) int {
+	var te *datastore.TimeoutError
+	var ue *datastore.UnavailableError
+	switch {
+	case errors.As(err, &te):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &ue):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// checkURL checks that raw is an acceptable destination, returning it
+// normalized
+func (s *Server) checkURL(ctx context.Context, raw string) (string, error) {
+	url, err := s.urls.Normalize(ctx, raw)
+	if r, ok := err.(*urls.Rejection); ok {
+		code := "invalid_url"
+		if r.Reason == urls.Private {
+			code = "url_blocked"
+		}
+		return "", &requestError{http.StatusBadRequest, code, r.Message}
+	}
+	return url, err
+}
+
+// lifetime describes how long a short url has left before it expires
+func lifetime(expiresAt *time.Time, maxClicks, clicks int, now time.Time) string {
+	var parts []string
+	if expiresAt != nil {
+		if left := expiresAt.Sub(now); left > 0 {
+			parts = append(parts, fmt.Sprintf("expires in %v", left.Truncate(time.Second)))
+		} else {
+			parts = append(parts, "expired")
+		}
+	}
+	if maxClicks > 0 {
+		if left := maxClicks - clicks; left > 0 {
+			parts = append(parts, fmt.Sprintf("%v of %v clicks left", left, maxClicks))
+		} else if expiresAt == nil || expiresAt.After(now) {
+			parts = append(parts, "expired")
+		}
+	}
+	if len(parts) == 0 {
+		return "never expires"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// protected notes on the info page if a short url needs a password
+func protected(u *datastore.URLMap) string {
+	if u.PasswordHash == "" {
+		return ""
+	}
+	return " It is password protected."
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+	"github.com/dabfleming/shorty/internal/urls"
+)
+
+const (
+	// defaultListLimit and maxListLimit bound how many links a page lists
+	defaultListLimit = 50
+	maxListLimit     = 500
+
+	// maxTags and maxTagLength bound the tags on a link
+	maxTags      = 10
+	maxTagLength = 32
+)
+
+// listLinks lists a page of the links the caller can see, chosen by the
+// query parameters:
+//
+//	limit   links per page, up to 500 (default 50)
+//	cursor  the next_cursor of the previous page
+//	sort    created, slug or clicks, prefixed with - for descending
+//	prefix  slugs starting with this
+//	host    destinations on this host
+//	owner   user:NAME, key:ID or workspace:ID
+//	tag     links with this tag
+//
+// It returns the links and the cursor for the next page, or nil if this is
+// the last. Bad parameters are returned as a *requestError.
+func (s *Server) listLinks(ctx context.Context, q url.Values) ([]datastore.VisitCount, *datastore.Cursor, error) {
+	opts := datastore.ListOptions{
+		Limit:      defaultListLimit,
+		SlugPrefix: q.Get("prefix"),
+		Tag:        strings.ToLower(q.Get("tag")),
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			return nil, nil, &requestError{http.StatusBadRequest, "invalid_limit", fmt.Sprintf("Limit must be a number from 1 to %d.", maxListLimit)}
+		}
+		opts.Limit = n
+	}
+
+	sort := q.Get("sort")
+	if strings.HasPrefix(sort, "-") {
+		opts.Desc, sort = true, sort[1:]
+	}
+	switch datastore.Sort(sort) {
+	case "", datastore.SortCreated, datastore.SortSlug, datastore.SortClicks:
+		opts.Sort = datastore.Sort(sort)
+	default:
+		return nil, nil, &requestError{http.StatusBadRequest, "invalid_sort", "Sort must be created, slug or clicks, optionally prefixed with - for descending."}
+	}
+
+	invalidCursor := &requestError{http.StatusBadRequest, "invalid_cursor", "The cursor is not valid for this listing; start again from the first page."}
+	if v := q.Get("cursor"); v != "" {
+		c, err := datastore.DecodeCursor(v)
+		if err != nil {
+			return nil, nil, invalidCursor
+		}
+		opts.Cursor = c
+	}
+
+	if v := q.Get("host"); v != "" {
+		host, err := urls.NormalizeHost(v)
+		if err != nil {
+			return nil, nil, &requestError{http.StatusBadRequest, "invalid_host", fmt.Sprintf("Host %q is not valid.", v)}
+		}
+		opts.Host = host
+	}
+
+	if v := q.Get("owner"); v != "" {
+		if err := s.parseOwner(ctx, v, &opts); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	vs, next, err := s.ds.ListURLs(ctx, s.scope(ctx, datastore.RoleViewer), opts)
+	if err == datastore.ErrInvalidCursor {
+		return nil, nil, invalidCursor
+	}
+	return vs, next, err
+}
+
+// parseOwner sets the owner filter in opts from user:NAME, key:ID or
+// workspace:ID
+func (s *Server) parseOwner(ctx context.Context, owner string, opts *datastore.ListOptions) error {
+	invalid := &requestError{http.StatusBadRequest, "invalid_owner", "Owner must be user:NAME, key:ID or workspace:ID."}
+
+	kind, value, ok := strings.Cut(owner, ":")
+	if !ok || value == "" {
+		return invalid
+	}
+	if kind == "user" {
+		u, err := s.ds.GetUserByUsername(ctx, normalizeUsername(value))
+		if err == datastore.ErrNotFound {
+			// Nobody owns anything with an id of -1
+			opts.UserID = -1
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		opts.UserID = u.ID
+		return nil
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		return invalid
+	}
+	switch kind {
+	case "key":
+		opts.APIKeyID = id
+	case "workspace":
+		opts.WorkspaceID = id
+	default:
+		return invalid
+	}
+	return nil
+}
+
+// parseTags checks the tags for a new link, returning them lower cased and
+// without duplicates. Problems are returned as a *requestError.
+func parseTags(tags []string) ([]string, error) {
+	var parsed []string
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if len(t) > maxTagLength || strings.IndexFunc(t, func(c rune) bool {
+			return !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_')
+		}) >= 0 {
+			return nil, &requestError{http.StatusBadRequest, "invalid_tags", fmt.Sprintf("Tag %q is not valid; tags are up to %d letters, digits, '-' or '_'.", t, maxTagLength)}
+		}
+		seen[t] = true
+		parsed = append(parsed, t)
+	}
+	if len(parsed) > maxTags {
+		return nil, &requestError{http.StatusBadRequest, "invalid_tags", fmt.Sprintf("Links can have at most %d tags.", maxTags)}
+	}
+	return parsed, nil
+}
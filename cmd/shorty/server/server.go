@@ -1,43 +1,199 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
+	"expvar"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/dabfleming/shorty/internal/config"
 	"github.com/dabfleming/shorty/internal/datastore"
+	"github.com/dabfleming/shorty/internal/redis"
 	"github.com/dabfleming/shorty/internal/slugs"
+	"github.com/dabfleming/shorty/internal/tracking"
+	"github.com/dabfleming/shorty/internal/urls"
 	"github.com/ua-parser/uap-go/uaparser"
 )
 
-const defaultSlugLength = 7
+// recorder is the visit recorder whose stats /debug/vars shows. expvar
+// names can only be published once per process, so the stats are published
+// here and a newer Server replaces an older one's recorder.
+var recorder atomic.Value // of *tracking.Recorder
+
+func init() {
+	expvar.Publish("tracking", expvar.Func(func() interface{} {
+		r, _ := recorder.Load().(*tracking.Recorder)
+		if r == nil {
+			return nil
+		}
+		return r.Stats()
+	}))
+}
 
 // Server models our http server
 type Server struct {
+	cfg    *config.Config
 	mux    *http.ServeMux
 	ds     datastore.Datastore
 	parser *uaparser.Parser
+	secret []byte
+	slugs  *slugs.Generator
+	ids    *slugs.IDEncoder // nil unless slugs are sequential
+	// validator checks requested slugs
+	validator *slugs.Validator
+	// urls checks and normalizes destinations
+	urls *urls.Validator
+	// hits records visits in the background
+	hits *tracking.Recorder
+	// clicks counts clicks in redis, if it is configured
+	clicks *tracking.Counter
 }
 
-// New returns a new server
-func New(ds datastore.Datastore, parser *uaparser.Parser) (Server, error) {
+// New returns a new server. rc is the redis client for click counts, or nil
+// to count visits in the datastore.
+func New(cfg *config.Config, ds datastore.Datastore, parser *uaparser.Parser, rc *redis.Client) (Server, error) {
 	s := Server{
+		cfg:    cfg,
 		ds:     ds,
 		parser: parser,
+		secret: []byte(cfg.Secret),
+		urls:   urls.NewValidator(cfg.BlockPrivateURLs),
 	}
 
+	alphabet, err := cfg.Alphabet()
+	if err != nil {
+		return s, err
+	}
+	s.slugs = slugs.NewGenerator(alphabet, cfg.SlugLength)
+	if cfg.SlugStrategy == "sequential" {
+		s.ids, err = slugs.NewIDEncoder(alphabet, cfg.SlugKey)
+		if err != nil {
+			return s, err
+		}
+	}
+
+	if len(s.secret) == 0 {
+		log.Printf("No secret configured, using a random one. Cookies will not survive a restart.")
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			return s, err
+		}
+	}
+
+	s.hits = tracking.NewRecorder(ds, tracking.Options{
+		QueueSize:     cfg.Tracking.QueueSize,
+		Workers:       cfg.Tracking.Workers,
+		BatchSize:     cfg.Tracking.BatchSize,
+		FlushInterval: cfg.Tracking.FlushInterval,
+	})
+	if rc != nil {
+		s.clicks = tracking.NewCounter(rc, ds, "shorty:clicks:")
+	}
+	recorder.Store(s.hits)
+
 	s.mux = http.NewServeMux()
-	s.mux.HandleFunc("/new", s.logMiddleware(s.newLinkHandler))
-	s.mux.HandleFunc("/info/", s.logMiddleware(s.infoHandler))
+	auth := cfg.Features.Auth
+	var reserved []string
+	route := func(pattern string, enabled bool, h http.HandlerFunc) {
+		reserved = append(reserved, strings.Split(strings.Trim(pattern, "/"), "/")[0])
+		if enabled {
+			s.mux.HandleFunc(pattern, s.logMiddleware(h))
+		}
+	}
+	route("/login", auth, s.loginHandler)
+	route("/logout", auth, s.logoutHandler)
+	route("/register", auth && cfg.Features.Registration, s.registerHandler)
+	route("/workspaces", auth, s.authMiddleware(s.workspacesHandler))
+	route("/workspaces/", auth, s.authMiddleware(s.workspacesHandler))
+	route("/new", true, s.authMiddleware(s.newLinkHandler))
+	route("/edit", true, s.authMiddleware(s.editLinkHandler))
+	route("/delete", true, s.authMiddleware(s.deleteLinkHandler))
+	route(apiPrefix, true, s.authMiddleware(s.apiHandler))
+	route("/info/", cfg.Features.Stats, s.authMiddleware(s.infoHandler))
+	route("/debug/vars", true, s.authMiddleware(s.varsHandler))
 	s.mux.HandleFunc("/", s.logMiddleware(s.routerHandler))
 
+	// Routes are reserved even when switched off, so a slug claimed now
+	// can't be hidden by turning them on later
+	var filter slugs.Filter
+	if cfg.SlugBlocklist != "" {
+		wl, err := slugs.LoadWordList(cfg.SlugBlocklist)
+		if err != nil {
+			return s, err
+		}
+		log.Printf("Loaded %d blocked words from %v", wl.Len(), cfg.SlugBlocklist)
+		filter = wl
+	}
+	rules := cfg.CustomSlugRules
+	s.validator = slugs.NewValidator(rules.Chars, rules.MinLength, rules.MaxLength, reserved, filter)
+
 	return s, nil
 }
 
-// Go runs the server
+// shutdownTimeout is how long requests in progress and queued visits get
+// to finish once the server is asked to stop
+const shutdownTimeout = 30 * time.Second
+
+// Go runs the server until it receives SIGINT or SIGTERM, then finishes
+// requests in progress and saves queued visits before returning
 func (s *Server) Go() {
-	log.Fatal(http.ListenAndServe(":8080", s.mux))
+	srv := &http.Server{
+		Addr:         s.cfg.Listen,
+		Handler:      s.mux,
+		ReadTimeout:  s.cfg.Timeouts.Read,
+		WriteTimeout: s.cfg.Timeouts.Write,
+		IdleTimeout:  s.cfg.Timeouts.Idle,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if s.clicks != nil {
+		go s.clicks.Run(ctx, s.cfg.Redis.ReconcileInterval)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		log.Printf("Shutting down")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down: %v", err)
+	}
+	if err := s.hits.Close(ctx); err != nil {
+		log.Printf("Error saving queued visits: %v", err)
+	}
+	stats := s.hits.Stats()
+	log.Printf("Recorded %d visits, dropped %d, failed %d", stats.Recorded, stats.Dropped, stats.Failed)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// varsHandler serves expvar metrics, like the visit queue's, to admins
+func (s *Server) varsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.scope(r.Context(), datastore.RoleViewer).All {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "Only admins can see metrics.")
+		return
+	}
+	expvar.Handler().ServeHTTP(w, r)
 }
 
 // logMiddleware logs some basic data on each request for debugging
@@ -50,21 +206,52 @@ func (s *Server) logMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 // routerHandler routes to the correct handler for short urls or the root page
 func (s *Server) routerHandler(w http.ResponseWriter, r *http.Request) {
-	// If this is not a request for /, assume it's a short URL and forward
+	// If this is not a request for /, assume it's a short URL and forward.
+	// Short urls are public, everything else needs an API key.
 	if len(r.URL.Path) > 1 {
 		s.forwardHandler(w, r)
 		return
 	}
+	s.authMiddleware(s.rootHandler)(w, r)
+}
+
+// rootHandler serves up a form to create links, and some links for testing
+func (s *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
+	account := ""
+	if u := userFrom(r.Context()); u != nil {
+		account = fmt.Sprintf(`<form method="post" action="/logout">Signed in as %v <a href="/workspaces">Workspaces</a> <input type="submit" value="Log out" /></form>`, html.EscapeString(u.Username))
+	}
+
+	// Offer the workspaces the user can create links in
+	workspaces := ""
+	for _, m := range workspacesFrom(r.Context()) {
+		if m.Role.Includes(datastore.RoleEditor) {
+			workspaces += fmt.Sprintf(`<option value="%d">%v</option>`, m.ID, html.EscapeString(m.Name))
+		}
+	}
+	if workspaces != "" {
+		workspaces = `Workspace: <select name="workspace"><option value="">Personal</option>` + workspaces + `</select><br />`
+	}
 
-	// request for /, serve up some links for testing
-	fmt.Fprint(w, `<!DOCTYPE html>
+	force := ""
+	if s.cfg.DedupeURLs {
+		force = `<label><input type="checkbox" name="force" value="1" /> New link even if I already have one to this URL</label><br />`
+	}
+
+	fmt.Fprintf(w, `<!DOCTYPE html>
 		<html>
 		<head><title>Shorty</title></head>
 		<body>
+		%v
 		<h2>Create Short Link</h2>
 		<form method="post" action="/new">
 		Full URL: <input type="text" name="url" value="https://" /><br />
 		Requested short url (optional): http://SERVER_NAME/<input type="text" name="slug" /><br />
+		Expires after (optional, e.g. 24h or 30m): <input type="text" name="expires_in" /><br />
+		Max clicks (optional): <input type="text" name="max_clicks" /><br />
+		Password (optional): <input type="password" name="password" /><br />
+		Tags (optional, comma separated): <input type="text" name="tags" /><br />
+		%v%v
 		<input type="submit" />
 		</form>
 		<h2><a href="/info/">View Link Stats</a></h2>
@@ -75,7 +262,7 @@ func (s *Server) routerHandler(w http.ResponseWriter, r *http.Request) {
 		<a href="/foo">foo (not found)</a><br />
 		</body>
 		</html>
-		`)
+		`, account, workspaces, force)
 }
 
 // forwardHandler forwards from a short url to the destination url
@@ -83,29 +270,85 @@ func (s *Server) routerHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) forwardHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	url, err := s.ds.GetURLBySlug(ctx, r.URL.Path[1:])
+	if err == datastore.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Printf("Error looking up url: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errorStatus(err))
 		return
 	}
 
-	if url.URL == "" {
-		w.WriteHeader(http.StatusNotFound)
+	// Expired links don't ask for a password they won't use, nor spend
+	// time checking one
+	if url.Expired(time.Now()) {
+		s.expired(w)
+		return
+	}
+
+	if url.PasswordHash != "" && !s.unlocked(r, url) && !s.unlock(w, r, url) {
+		return
+	}
+
+	// With redis every click is counted there, and click limits are checked
+	// against that count rather than saved visits, so the link may only
+	// turn out to be used up now
+	counted := false
+	if s.clicks != nil {
+		n, err := s.clicks.Click(ctx, url.ID)
+		if err != nil {
+			log.Printf("Error counting click: %v", err)
+		} else {
+			url.Clicks, counted = n-1, true
+		}
+	}
+	if counted && url.Expired(time.Now()) {
+		if err := s.clicks.Unclick(ctx, url.ID); err != nil {
+			log.Printf("Error taking back click: %v", err)
+		}
+		s.expired(w)
 		return
 	}
 
 	// Track the visit
 	ua := r.Header.Get("User-Agent")
 	client := s.parser.Parse(ua)
-	ip := r.RemoteAddr
-	// TODO Remove port from address
-	err = s.ds.TrackHit(ctx, url.ID, client, ip)
-	if err != nil {
-		log.Printf("Error tracking hit: %v", err)
+	hit := datastore.Hit{
+		URLID:   url.ID,
+		Device:  client.Device.Family,
+		OS:      client.Os.Family,
+		Browser: client.UserAgent.Family,
+		IP:      r.RemoteAddr, // TODO Remove port from address
+		Time:    time.Now(),
+	}
+	if url.MaxClicks > 0 && !counted {
+		// Click limits are checked against saved visits, so these can't wait
+		if err := s.ds.TrackHits(ctx, []datastore.Hit{hit}); err != nil {
+			log.Printf("Error tracking hit: %v", err)
+		}
+	} else {
+		s.hits.Record(hit)
 	}
 
+	// After the unlock form, make sure the browser doesn't repeat the POST
+	status := http.StatusTemporaryRedirect
+	if r.Method == "POST" {
+		status = http.StatusSeeOther
+	}
 	w.Header().Set("Location", url.URL)
-	w.WriteHeader(http.StatusTemporaryRedirect)
+	w.WriteHeader(status)
+}
+
+// expired responds to a visit to an expired short url
+func (s *Server) expired(w http.ResponseWriter) {
+	if s.cfg.ExpiredURL != "" {
+		w.Header().Set("Location", s.cfg.ExpiredURL)
+		w.WriteHeader(http.StatusTemporaryRedirect)
+		return
+	}
+	w.WriteHeader(http.StatusGone)
+	fmt.Fprint(w, "This short url has expired.")
 }
 
 // newLinkHandler handles a request to create a new short url
@@ -121,55 +364,141 @@ func (s *Server) newLinkHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse form
 	err := r.ParseForm()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errorStatus(err))
 		log.Printf("Error parsing form: %v", err)
 		return
 	}
 
-	// Checks on URL
-	url := r.PostForm.Get("url")
-	if url == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Must include a URL.")
+	u := &datastore.URLMap{
+		URL:  r.PostForm.Get("url"),
+		Slug: r.PostForm.Get("slug"),
+		Tags: strings.Split(r.PostForm.Get("tags"), ","),
+	}
+	u.ExpiresAt, u.MaxClicks, err = parseLimits(r.PostForm.Get("expires_in"), r.PostForm.Get("max_clicks"))
+	if ws := r.PostForm.Get("workspace"); err == nil && ws != "" {
+		u.WorkspaceID, err = strconv.Atoi(ws)
+		if err != nil {
+			err = &requestError{http.StatusBadRequest, "invalid_workspace", "Invalid workspace."}
+		}
+	}
+	existing := false
+	if err == nil {
+		existing, err = s.createLink(ctx, u, r.PostForm.Get("password"), r.PostForm.Get("force") != "")
+	}
+	if re, ok := err.(*requestError); ok {
+		w.WriteHeader(re.Status)
+		fmt.Fprint(w, html.EscapeString(re.Message))
 		return
 	}
-	if strings.HasPrefix(url, "http://") == false && strings.HasPrefix(url, "https://") == false {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "URL must begin with 'http://' or 'https://'.")
+	if err != nil {
+		log.Printf("Error saving new short url: %T, %v", err, err)
+		w.WriteHeader(errorStatus(err))
+		fmt.Fprint(w, "Error: "+html.EscapeString(err.Error()))
 		return
 	}
 
-	// Check for requested slug
-	slug := r.PostForm.Get("slug")
-	if slug == "" {
-		// Generate a random slug
-		// TODO Cope better with collisions
-		slug = slugs.Random(defaultSlugLength)
+	heading := "Link Created"
+	if existing {
+		heading = "You Already Have This Link"
+	} else {
+		w.WriteHeader(http.StatusCreated)
 	}
+	fmt.Fprintf(w, `<!DOCTYPE html>
+		<html>
+		<head><title>Shorty</title></head>
+		<body>
+		<h2>%v:</h2>
+		<a href="/%v">/%v</a> now links to: <pre>%v</pre>
+		<p>It %v.</p>
+		</body></html>`, heading, url.PathEscape(u.Slug), html.EscapeString(u.Slug), html.EscapeString(u.URL), lifetime(u.ExpiresAt, u.MaxClicks, 0, time.Now()))
+}
+
+// editLinkHandler handles a request to change where a short url points
+func (s *Server) editLinkHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
-	// Request to save to DB
-	err = s.ds.SaveNewURL(ctx, slug, url)
-	if err != nil && strings.HasPrefix(err.Error(), "Error 1062") {
-		// Duplicate slug
-		w.WriteHeader(http.StatusConflict)
-		fmt.Fprintf(w, "Error, the short url '%v' is already in use.", slug)
+	// Check method
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+
+	// Parse form
+	err := r.ParseForm()
 	if err != nil {
-		log.Printf("Error saving new short url: %T, %v", err, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error: %v", err)
+		w.WriteHeader(errorStatus(err))
+		log.Printf("Error parsing form: %v", err)
+		return
+	}
+
+	slug := r.PostForm.Get("slug")
+	dest := r.PostForm.Get("url")
+	err = s.updateLink(ctx, slug, dest)
+	if re, ok := err.(*requestError); ok {
+		w.WriteHeader(re.Status)
+		fmt.Fprint(w, html.EscapeString(re.Message))
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating short url: %v", err)
+		w.WriteHeader(errorStatus(err))
+		fmt.Fprint(w, "Error: "+html.EscapeString(err.Error()))
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
 	fmt.Fprintf(w, `<!DOCTYPE html>
 		<html>
 		<head><title>Shorty</title></head>
 		<body>
-		<h2>Link Created:</h2>
+		<h2>Link Updated:</h2>
 		<a href="/%v">/%v</a> now links to: <pre>%v</pre>
-		</body></html>`, slug, slug, url)
+		</body></html>`, url.PathEscape(slug), html.EscapeString(slug), html.EscapeString(dest))
+}
+
+// deleteLinkHandler handles a request to delete a short url
+func (s *Server) deleteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Check method
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse form
+	err := r.ParseForm()
+	if err != nil {
+		w.WriteHeader(errorStatus(err))
+		log.Printf("Error parsing form: %v", err)
+		return
+	}
+
+	slug := r.PostForm.Get("slug")
+	purge := r.PostForm.Get("purge") != ""
+	err = s.deleteLink(ctx, slug, purge)
+	if re, ok := err.(*requestError); ok {
+		w.WriteHeader(re.Status)
+		fmt.Fprint(w, html.EscapeString(re.Message))
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting short url: %v", err)
+		w.WriteHeader(errorStatus(err))
+		fmt.Fprint(w, "Error: "+html.EscapeString(err.Error()))
+		return
+	}
+
+	history := "Its visit history has been kept."
+	if purge {
+		history = "Its visit history has been deleted."
+	}
+	fmt.Fprintf(w, `<!DOCTYPE html>
+		<html>
+		<head><title>Shorty</title></head>
+		<body>
+		<h2>Link Deleted:</h2>
+		<p>/%v no longer links anywhere. %v</p>
+		</body></html>`, html.EscapeString(slug), history)
 }
 
 // infoHandler displays visit counts for each short url
@@ -182,54 +511,132 @@ func (s *Server) infoHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	vs, err := s.ds.GetVisitCounts(ctx)
+	q := r.URL.Query()
+	vs, next, err := s.listLinks(ctx, q)
+	if re, ok := err.(*requestError); ok {
+		w.WriteHeader(re.Status)
+		fmt.Fprint(w, html.EscapeString(re.Message))
+		return
+	}
 	if err != nil {
 		log.Printf("Error getting visitor counts: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errorStatus(err))
 		return
 	}
 
-	fmt.Fprint(w, `<!DOCTYPE html>
+	fmt.Fprintf(w, `<!DOCTYPE html>
 		<html>
 		<head><title>Shorty</title></head>
 		<body>
 		<h2>Visits:</h2>
+		<form method="get" action="/info/">
+		<input type="hidden" name="sort" value="%v" />
+		Slug starts with: <input type="text" name="prefix" value="%v" />
+		Host: <input type="text" name="host" value="%v" />
+		Owner (user:NAME, key:ID or workspace:ID): <input type="text" name="owner" value="%v" />
+		Tag: <input type="text" name="tag" value="%v" />
+		<input type="submit" value="Filter" />
+		</form>
 		<table border="2">
-		<tr><th>Short URL</th><th>Full URL</th><th>Visit Count</th></tr>
-		`)
+		<tr><th>%v</th><th>Full URL</th><th>Workspace</th><th>Tags</th><th>%v</th><th>%v</th><th>Lifetime</th></tr>
+		`, html.EscapeString(q.Get("sort")), html.EscapeString(q.Get("prefix")), html.EscapeString(q.Get("host")),
+		html.EscapeString(q.Get("owner")), html.EscapeString(q.Get("tag")),
+		sortLink(q, "slug", "Short URL"), sortLink(q, "created", "Created"), sortLink(q, "clicks", "Visit Count"))
+	now := time.Now()
 	for _, v := range vs {
-		fmt.Fprintf(w, `<tr><td><a href="/info/%v">%v</a></td><td>%v</td><td>%v</td></tr>`, v.Slug, v.Slug, v.URL, v.Count)
+		created := ""
+		if v.CreatedAt != nil {
+			created = v.CreatedAt.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, `<tr><td><a href="/info/%v">%v</a></td><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td></tr>`,
+			url.PathEscape(v.Slug), html.EscapeString(v.Slug), html.EscapeString(v.URL), html.EscapeString(workspaceName(ctx, v.WorkspaceID)),
+			html.EscapeString(strings.Join(v.Tags, ", ")), created, v.Count, lifetime(v.ExpiresAt, v.MaxClicks, v.Count, now))
 	}
 	fmt.Fprint(w, `</table>
-		</body>
+		`)
+	if next != nil {
+		q.Set("cursor", next.Encode())
+		fmt.Fprintf(w, `<p><a href="/info/?%v">Next page</a></p>
+		`, html.EscapeString(q.Encode()))
+	}
+	fmt.Fprint(w, `</body>
 		</html>
 		`)
 }
 
+// sortLink links a column heading on the info page to sorting by it,
+// keeping the filters. Clicking the current sort reverses it.
+func sortLink(q url.Values, sort, label string) string {
+	current := q.Get("sort")
+	if current == "" {
+		current = "created"
+	}
+	q2 := url.Values{}
+	for k, v := range q {
+		q2[k] = v
+	}
+	q2.Del("cursor")
+	switch current {
+	case sort:
+		q2.Set("sort", "-"+sort)
+		label += " &uarr;"
+	case "-" + sort:
+		q2.Set("sort", sort)
+		label += " &darr;"
+	default:
+		q2.Set("sort", sort)
+	}
+	return fmt.Sprintf(`<a href="/info/?%v">%v</a>`, html.EscapeString(q2.Encode()), label)
+}
+
 // infoDetailHandler displays visit details for a single short url
 func (s *Server) infoDetailHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	slug := strings.TrimPrefix(r.URL.Path, "/info/")
 
-	url, visits, err := s.ds.GetVisits(ctx, slug)
+	url, visits, err := s.ds.GetVisits(ctx, slug, s.scope(ctx, datastore.RoleViewer))
+	if err == datastore.ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Printf("Error getting visits: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(errorStatus(err))
 		return
 	}
 
+	// Viewers can't change the link, so don't offer to
+	forms := ""
+	if s.scope(ctx, datastore.RoleEditor).Allows(url) {
+		forms = fmt.Sprintf(`<form method="post" action="/edit">
+		<input type="hidden" name="slug" value="%v" />
+		New URL: <input type="text" name="url" value="%v" />
+		<input type="submit" value="Update" />
+		</form>
+		<form method="post" action="/delete">
+		<input type="hidden" name="slug" value="%v" />
+		<label><input type="checkbox" name="purge" value="1" /> Also delete visit history</label>
+		<input type="submit" value="Delete" />
+		</form>`, html.EscapeString(url.Slug), html.EscapeString(url.URL), html.EscapeString(url.Slug))
+	}
+
 	fmt.Fprintf(w, `<!DOCTYPE html>
 		<html>
 		<head><title>Shorty</title></head>
 		<body>
 		<h2>Visits to /%v</h2>
 		<pre>%v</pre>
+		<p>This link %v.%v</p>
+		<p>Workspace: %v</p>
+		%v
 		<p>Visit detail, most recent first.</p>
 		<table border="2">
 		<tr><th>Device</th><th>OS</th><th>Browser</th><th>IP</th><th>Time</th></tr>
-		`, url.Slug, url.URL)
+		`, html.EscapeString(url.Slug), html.EscapeString(url.URL), lifetime(url.ExpiresAt, url.MaxClicks, len(visits), time.Now()), protected(url), html.EscapeString(workspaceName(ctx, url.WorkspaceID)), forms)
 	for _, v := range visits {
-		fmt.Fprintf(w, `<tr><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td></tr>`, v.Device, v.OS, v.Browser, v.IP, v.Time)
+		// Device, OS and browser come from the visitor's User-Agent
+		fmt.Fprintf(w, `<tr><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td></tr>`,
+			html.EscapeString(v.Device), html.EscapeString(v.OS), html.EscapeString(v.Browser), html.EscapeString(v.IP), v.Time)
 	}
 	fmt.Fprint(w, `</table>
 		</body>
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dabfleming/shorty/internal/config"
+	"github.com/dabfleming/shorty/internal/datastore"
+	"github.com/ua-parser/uap-go/uaparser"
+)
+
+// testParser is shared, as loading the user agent rules is slow
+var testParser = uaparser.NewFromSaved()
+
+// newTestServer returns a Server on an empty memory datastore, with
+// authentication off. configure, if not nil, can change the configuration
+// first.
+func newTestServer(t *testing.T, configure func(*config.Config)) *Server {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Datastore = "memory"
+	cfg.Features.Auth = false
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	s, err := New(&cfg, datastore.NewMemory(), testParser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := s.hits.Close(context.Background()); err != nil {
+			t.Error(err)
+		}
+	})
+	return &s
+}
+
+func TestNewTwice(t *testing.T) {
+	a := newTestServer(t, nil)
+	b := newTestServer(t, nil)
+	if a.hits == b.hits {
+		t.Error("servers share a visit recorder")
+	}
+}
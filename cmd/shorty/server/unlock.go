@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+	"github.com/dabfleming/shorty/internal/passwords"
+)
+
+// unlockCookie remembers that a visitor has entered the password for a
+// short url. It is scoped to the path the visitor used, which may differ
+// from the slug when slugs are case insensitive.
+const (
+	unlockCookie = "shorty_unlock"
+	unlockTTL    = 30 * time.Minute
+)
+
+// unlocked reports whether the request carries a valid unlock cookie for url
+func (s *Server) unlocked(r *http.Request, url *datastore.URLMap) bool {
+	c, err := r.Cookie(unlockCookie)
+	if err != nil {
+		return false
+	}
+
+	// Binding the cookie to the password hash means changing the password
+	// invalidates it
+	value, ok := s.verify(c.Value, url.PasswordHash)
+	if !ok {
+		return false
+	}
+
+	parts := strings.Split(value, "|")
+	if len(parts) != 2 || parts[0] != strconv.Itoa(url.ID) {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Now().Unix() < expires
+}
+
+// unlock handles a visit to a password protected url without an unlock
+// cookie. A correct password POSTed from the unlock form sets the cookie
+// and returns true so the visitor is forwarded; otherwise the form is served
+// and it returns false.
+func (s *Server) unlock(w http.ResponseWriter, r *http.Request, url *datastore.URLMap) bool {
+	status := http.StatusOK
+	msg := ""
+
+	if r.Method == "POST" {
+		err := r.ParseForm()
+		if err != nil {
+			w.WriteHeader(errorStatus(err))
+			log.Printf("Error parsing form: %v", err)
+			return false
+		}
+
+		ok, err := passwords.Check(url.PasswordHash, r.PostForm.Get("password"))
+		if err != nil {
+			log.Printf("Error checking password for /%v: %v", url.Slug, err)
+			w.WriteHeader(errorStatus(err))
+			return false
+		}
+		if ok {
+			expires := time.Now().Add(unlockTTL)
+			value := fmt.Sprintf("%d|%d", url.ID, expires.Unix())
+			http.SetCookie(w, &http.Cookie{
+				Name:     unlockCookie,
+				Value:    s.sign(value, url.PasswordHash),
+				Path:     r.URL.EscapedPath(),
+				Expires:  expires,
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			return true
+		}
+
+		status = http.StatusForbidden
+		msg = "<p>Incorrect password, please try again.</p>"
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<!DOCTYPE html>
+		<html>
+		<head><title>Shorty</title></head>
+		<body>
+		<h2>This link is password protected</h2>
+		%v
+		<form method="post" action="%v">
+		Password: <input type="password" name="password" autofocus />
+		<input type="submit" value="Continue" />
+		</form>
+		</body>
+		</html>
+		`, msg, html.EscapeString(r.URL.EscapedPath()))
+	return false
+}
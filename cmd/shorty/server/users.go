@@ -0,0 +1,252 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+	"github.com/dabfleming/shorty/internal/passwords"
+)
+
+// sessionCookie holds the token for a signed in user's session
+const (
+	sessionCookie = "shorty_session"
+	sessionTTL    = 30 * 24 * time.Hour
+)
+
+// Limits on usernames and passwords
+const (
+	minUsername = 3
+	maxUsername = 32
+	minPassword = 8
+)
+
+// sessionUser returns the user signed in with the request's session cookie,
+// or nil if there isn't one or it has expired
+func (s *Server) sessionUser(r *http.Request) (*datastore.User, error) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+
+	ctx := r.Context()
+	hash := passwords.HashToken(c.Value)
+	sess, err := s.ds.GetSessionByHash(ctx, hash)
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(sess.ExpiresAt) {
+		return nil, s.ds.DeleteSession(ctx, hash)
+	}
+
+	u, err := s.ds.GetUser(ctx, sess.UserID)
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	return u, err
+}
+
+// startSession signs the user in, setting a cookie for a new session
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, u *datastore.User) error {
+	token, hash, err := passwords.NewToken("")
+	if err != nil {
+		return err
+	}
+
+	sess := &datastore.Session{
+		Hash:      hash,
+		UserID:    u.ID,
+		ExpiresAt: time.Now().Add(sessionTTL).Truncate(time.Second),
+	}
+	if err := s.ds.SaveSession(r.Context(), sess); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  sess.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// loginHandler serves the login form and signs users in
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	msg := ""
+
+	if r.Method == "POST" {
+		err := r.ParseForm()
+		if err != nil {
+			w.WriteHeader(errorStatus(err))
+			log.Printf("Error parsing form: %v", err)
+			return
+		}
+
+		u, err := s.ds.GetUserByUsername(r.Context(), normalizeUsername(r.PostForm.Get("username")))
+		ok := false
+		switch err {
+		case nil:
+			ok, err = passwords.Check(u.PasswordHash, r.PostForm.Get("password"))
+		case datastore.ErrNotFound:
+			passwords.CheckMissing(r.PostForm.Get("password"))
+		}
+		if err != nil && err != datastore.ErrNotFound {
+			log.Printf("Error logging in: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+		if ok {
+			if err := s.startSession(w, r, u); err != nil {
+				log.Printf("Error starting session: %v", err)
+				w.WriteHeader(errorStatus(err))
+				return
+			}
+			http.Redirect(w, r, localPath(r.FormValue("next")), http.StatusSeeOther)
+			return
+		}
+
+		status = http.StatusForbidden
+		msg = "<p>Incorrect username or password.</p>"
+	}
+
+	register := ""
+	if s.cfg.Features.Registration {
+		register = `<p>No account? <a href="/register">Register</a></p>`
+	}
+	s.accountForm(w, r, status, "Log In", "/login", msg+register)
+}
+
+// registerHandler serves the registration form and creates users, signing
+// them straight in
+func (s *Server) registerHandler(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	msg := ""
+
+	if r.Method == "POST" {
+		err := r.ParseForm()
+		if err != nil {
+			w.WriteHeader(errorStatus(err))
+			log.Printf("Error parsing form: %v", err)
+			return
+		}
+
+		u := &datastore.User{Username: normalizeUsername(r.PostForm.Get("username"))}
+		err = checkAccount(u.Username, r.PostForm.Get("password"))
+		if err == nil {
+			u.PasswordHash, err = passwords.Hash(r.PostForm.Get("password"))
+			if err == nil {
+				err = s.ds.SaveUser(r.Context(), u)
+			}
+		}
+		if err == datastore.ErrUsernameTaken {
+			err = &requestError{http.StatusConflict, "username_taken", fmt.Sprintf("The username '%v' is already in use.", u.Username)}
+		}
+		if err == nil {
+			err = s.startSession(w, r, u)
+		}
+
+		if re, ok := err.(*requestError); ok {
+			status = re.Status
+			msg = "<p>" + html.EscapeString(re.Message) + "</p>"
+		} else if err != nil {
+			log.Printf("Error registering user: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		} else {
+			http.Redirect(w, r, localPath(r.FormValue("next")), http.StatusSeeOther)
+			return
+		}
+	}
+
+	s.accountForm(w, r, status, "Register", "/register", msg+`<p>Already registered? <a href="/login">Log in</a></p>`)
+}
+
+// logoutHandler ends the current session
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if err := s.ds.DeleteSession(r.Context(), passwords.HashToken(c.Value)); err != nil {
+			log.Printf("Error deleting session: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// accountForm writes the username and password form used to log in and
+// register. msg is HTML shown above the form.
+func (s *Server) accountForm(w http.ResponseWriter, r *http.Request, status int, title, action, msg string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<!DOCTYPE html>
+		<html>
+		<head><title>Shorty</title></head>
+		<body>
+		<h2>%v</h2>
+		%v
+		<form method="post" action="%v">
+		<input type="hidden" name="next" value="%v" />
+		Username: <input type="text" name="username" autofocus /><br />
+		Password: <input type="password" name="password" /><br />
+		<input type="submit" value="%v" />
+		</form>
+		</body>
+		</html>
+		`, title, msg, action, html.EscapeString(localPath(r.FormValue("next"))), title)
+}
+
+// normalizeUsername makes usernames case insensitive
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// checkAccount checks a new user's username and password
+func checkAccount(username, password string) error {
+	if len(username) < minUsername || len(username) > maxUsername {
+		return &requestError{http.StatusBadRequest, "invalid_username", fmt.Sprintf("Usernames must be %d to %d characters long.", minUsername, maxUsername)}
+	}
+	for _, c := range username {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			return &requestError{http.StatusBadRequest, "invalid_username", "Usernames may only contain letters, numbers, '_', '.' and '-'."}
+		}
+	}
+	if len(password) < minPassword {
+		return &requestError{http.StatusBadRequest, "invalid_password", fmt.Sprintf("Passwords must be at least %d characters long.", minPassword)}
+	}
+	return nil
+}
+
+// localPath returns next if it is a path on this server, or / otherwise, so
+// the login form can't be used to redirect people to other sites
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, `/\`) {
+		return "/"
+	}
+	return next
+}
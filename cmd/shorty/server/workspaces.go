@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+)
+
+// maxWorkspaceName limits the length of workspace names
+const maxWorkspaceName = 100
+
+// workspacesHandler lists the signed in user's workspaces and creates new
+// ones, and hands requests for a single workspace to workspaceHandler
+func (s *Server) workspacesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if id := strings.TrimPrefix(r.URL.Path, "/workspaces/"); id != r.URL.Path && id != "" {
+		s.workspaceHandler(w, r, id)
+		return
+	}
+
+	u := userFrom(ctx)
+	if u == nil {
+		// Workspaces are shared between users, not API keys
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "Workspaces are only available to signed in users.")
+		return
+	}
+
+	if r.Method == "POST" {
+		err := r.ParseForm()
+		if err != nil {
+			w.WriteHeader(errorStatus(err))
+			log.Printf("Error parsing form: %v", err)
+			return
+		}
+
+		ws := &datastore.Workspace{Name: strings.TrimSpace(r.PostForm.Get("name"))}
+		if ws.Name == "" || len(ws.Name) > maxWorkspaceName {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Workspace names must be 1 to %d characters long.", maxWorkspaceName)
+			return
+		}
+		if err := s.ds.SaveWorkspace(ctx, ws, u.ID); err != nil {
+			log.Printf("Error saving workspace: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/workspaces/%d", ws.ID), http.StatusSeeOther)
+		return
+	}
+
+	fmt.Fprint(w, `<!DOCTYPE html>
+		<html>
+		<head><title>Shorty</title></head>
+		<body>
+		<h2>Workspaces</h2>
+		<table border="2">
+		<tr><th>Name</th><th>Your Role</th></tr>
+		`)
+	for _, m := range workspacesFrom(ctx) {
+		fmt.Fprintf(w, `<tr><td><a href="/workspaces/%d">%v</a></td><td>%v</td></tr>`, m.ID, html.EscapeString(m.Name), m.Role)
+	}
+	fmt.Fprint(w, `</table>
+		<h2>Create Workspace</h2>
+		<form method="post" action="/workspaces">
+		Name: <input type="text" name="name" />
+		<input type="submit" value="Create" />
+		</form>
+		</body>
+		</html>
+		`)
+}
+
+// workspaceHandler shows a workspace's members, and lets owners add, change
+// and remove them
+func (s *Server) workspaceHandler(w http.ResponseWriter, r *http.Request, idStr string) {
+	ctx := r.Context()
+
+	// Only members can tell a workspace exists
+	id, err := strconv.Atoi(idStr)
+	role := datastore.Role("")
+	if err == nil {
+		role = roleIn(ctx, id)
+	}
+	if role == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if r.Method == "POST" {
+		if !role.Includes(datastore.RoleOwner) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "Only owners can manage a workspace's members.")
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			w.WriteHeader(errorStatus(err))
+			log.Printf("Error parsing form: %v", err)
+			return
+		}
+
+		err = s.changeMember(r, id)
+		if re, ok := err.(*requestError); ok {
+			w.WriteHeader(re.Status)
+			fmt.Fprint(w, html.EscapeString(re.Message))
+			return
+		}
+		if err != nil {
+			log.Printf("Error changing workspace member: %v", err)
+			w.WriteHeader(errorStatus(err))
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/workspaces/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	members, err := s.ds.GetMembers(ctx, id)
+	if err != nil {
+		log.Printf("Error getting workspace members: %v", err)
+		w.WriteHeader(errorStatus(err))
+		return
+	}
+
+	fmt.Fprintf(w, `<!DOCTYPE html>
+		<html>
+		<head><title>Shorty</title></head>
+		<body>
+		<h2>Workspace %v</h2>
+		<p>Owners manage members, editors create, edit and delete links, and viewers see links and their visits.</p>
+		<table border="2">
+		<tr><th>Member</th><th>Role</th></tr>
+		`, html.EscapeString(workspaceName(ctx, id)))
+	for _, m := range members {
+		remove := ""
+		if role.Includes(datastore.RoleOwner) {
+			remove = fmt.Sprintf(`<form method="post"><input type="hidden" name="action" value="remove" /><input type="hidden" name="username" value="%v" /><input type="submit" value="Remove" /></form>`, html.EscapeString(m.Username))
+		}
+		fmt.Fprintf(w, `<tr><td>%v</td><td>%v</td><td>%v</td></tr>`, html.EscapeString(m.Username), m.Role, remove)
+	}
+	fmt.Fprint(w, `</table>`)
+	if role.Includes(datastore.RoleOwner) {
+		fmt.Fprint(w, `
+		<h2>Add or Change Member</h2>
+		<form method="post">
+		<input type="hidden" name="action" value="set" />
+		Username: <input type="text" name="username" />
+		<select name="role"><option>viewer</option><option>editor</option><option>owner</option></select>
+		<input type="submit" value="Save" />
+		</form>`)
+	}
+	fmt.Fprint(w, `
+		</body>
+		</html>
+		`)
+}
+
+// changeMember sets or removes a workspace member's role from the posted
+// form, making sure the workspace keeps at least one owner
+func (s *Server) changeMember(r *http.Request, workspaceID int) error {
+	ctx := r.Context()
+
+	action := r.PostForm.Get("action")
+	role := datastore.Role(r.PostForm.Get("role"))
+	if action != "remove" && (action != "set" || !role.Valid()) {
+		return &requestError{http.StatusBadRequest, "invalid_role", "Role must be viewer, editor or owner."}
+	}
+
+	u, err := s.ds.GetUserByUsername(ctx, normalizeUsername(r.PostForm.Get("username")))
+	if err == datastore.ErrNotFound {
+		return &requestError{http.StatusBadRequest, "unknown_user", "There is no user with that username."}
+	}
+	if err != nil {
+		return err
+	}
+
+	if action == "remove" {
+		err = s.ds.RemoveMember(ctx, workspaceID, u.ID)
+		if err == datastore.ErrNotFound {
+			return &requestError{http.StatusBadRequest, "unknown_user", "That user isn't a member of this workspace."}
+		}
+	} else {
+		err = s.ds.SetMember(ctx, workspaceID, u.ID, role)
+	}
+	if err == datastore.ErrLastOwner {
+		return &requestError{http.StatusBadRequest, "last_owner", "A workspace needs at least one owner."}
+	}
+	return err
+}
+
+// workspaceName names a url's workspace for display
+func workspaceName(ctx context.Context, id int) string {
+	if id == 0 {
+		return "Personal"
+	}
+	for _, m := range workspacesFrom(ctx) {
+		if m.ID == id {
+			return m.Name
+		}
+	}
+	return fmt.Sprintf("#%d", id)
+}
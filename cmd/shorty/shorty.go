@@ -1,34 +1,227 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/dabfleming/shorty/cmd/shorty/server"
+	"github.com/dabfleming/shorty/internal/config"
 	"github.com/dabfleming/shorty/internal/datastore"
+	"github.com/dabfleming/shorty/internal/migrations"
 	"github.com/dabfleming/shorty/internal/platform/mysql"
+	"github.com/dabfleming/shorty/internal/platform/postgres"
+	"github.com/dabfleming/shorty/internal/platform/sqlite"
+	"github.com/dabfleming/shorty/internal/redis"
 	"github.com/ua-parser/uap-go/uaparser"
 )
 
 func main() {
-	// Connect to DB
-	db, err := mysql.Connect()
+	cfg, args, err := config.Load(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
 	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	// shorty config: print the effective configuration
+	if len(args) > 0 && args[0] == "config" {
+		if err := cfg.Dump(os.Stdout); err != nil {
+			log.Fatalf("Error printing config: %v", err)
+		}
+		return
+	}
+
+	// Connect to DB, unless we're running from memory
+	var db *sql.DB
+	if cfg.Datastore != "memory" {
+		db, err = connect(cfg.Datastore, cfg.DSN)
+		if err != nil {
+			log.Fatalf("Error connecting to database: %v", err)
+		}
+	}
+
+	// shorty migrate ...
+	if len(args) > 0 && args[0] == "migrate" {
+		if db == nil {
+			log.Fatalf("The %v datastore has no schema to migrate", cfg.Datastore)
+		}
+		if err := runMigrate(db, cfg.Datastore, args[1:]); err != nil {
+			log.Fatalf("Error migrating: %v", err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] != "apikey" && args[0] != "slugs" {
+		log.Fatalf("Unknown command %q, want config, migrate, apikey or slugs", args[0])
+	}
+
+	if cfg.Migrate && db != nil {
+		if err := migrateUp(context.Background(), db, cfg.Datastore); err != nil {
+			log.Fatalf("Error migrating: %v", err)
+		}
 	}
 
 	// Instantiate datastore
-	ds, err := datastore.New(db)
+	ds, err := newDatastore(cfg.Datastore, db)
 	if err != nil {
 		log.Fatalf("Error creating datastore: %v", err)
 	}
 
+	// shorty slugs ...
+	if len(args) > 0 && args[0] == "slugs" {
+		if err := runSlugs(ds, args[1:]); err != nil {
+			log.Fatalf("Error checking slugs: %v", err)
+		}
+		return
+	}
+
+	// shorty apikey ...
+	if len(args) > 0 {
+		if db == nil {
+			log.Fatalf("The %v datastore doesn't keep API keys between runs", cfg.Datastore)
+		}
+		if err := runAPIKey(ds, args[1:]); err != nil {
+			log.Fatalf("Error managing API keys: %v", err)
+		}
+		return
+	}
+
+	// An in memory datastore starts empty, so there would be no way in
+	if cfg.Datastore == "memory" && cfg.Features.Auth {
+		_, token, err := createAPIKey(context.Background(), ds, "memory admin", true)
+		if err != nil {
+			log.Fatalf("Error creating API key: %v", err)
+		}
+		log.Printf("Created admin API key for this run: %v", token)
+	} else if cfg.Features.Auth {
+		// Auth is on by default, so databases from before API keys would
+		// otherwise find the API closed without a word
+		keys, err := ds.GetAPIKeys(context.Background())
+		if err != nil {
+			log.Fatalf("Error checking API keys: %v", err)
+		}
+		live := 0
+		for _, k := range keys {
+			if k.RevokedAt == nil {
+				live++
+			}
+		}
+		if live == 0 {
+			log.Printf("Authentication is on but there are no API keys, so the API will refuse every request; create one with `shorty apikey create -admin <name>`, or set auth: false")
+		}
+	}
+
+	var rc *redis.Client
+	if cfg.Redis.Addr != "" {
+		rc, err = connectRedis(cfg.Redis, cfg.Timeouts.Redis)
+		if err != nil {
+			log.Fatalf("Error connecting to redis: %v", err)
+		}
+	}
+
+	// Deadlines go inside the cache, so time spent on a stalled redis can't
+	// use up the database's. Redis commands have their own, shorter timeout.
+	ds = datastore.WithDeadlines(ds, cfg.Timeouts.Query)
+
+	// The cache goes inside FoldCase, so it only sees folded slugs. With
+	// redis every instance shares it.
+	if cfg.Cache.Size > 0 {
+		cache := datastore.NewLRU(cfg.Cache.Size)
+		if rc != nil {
+			cache = datastore.NewRedisCache(rc, "shorty:url:")
+		}
+		ds = datastore.Cached(ds, cache, cfg.Cache.TTL, cfg.Cache.NegativeTTL)
+	}
+
+	if cfg.CaseInsensitiveSlugs {
+		n, err := unfoldedSlugs(context.Background(), ds)
+		if err != nil {
+			log.Fatalf("Error checking slugs: %v", err)
+		}
+		if n > 0 {
+			log.Fatalf("%d slugs aren't lower case and couldn't be found with case insensitive slugs; run `shorty slugs fold` first", n)
+		}
+		ds = datastore.FoldCase(ds)
+	}
+
 	// User-Agent Parser
 	parser := uaparser.NewFromSaved()
 
 	// Start Server
-	s, err := server.New(ds, parser)
+	s, err := server.New(cfg, ds, parser, rc)
 	if err != nil {
 		log.Fatalf("Error creating server: %v", err)
 	}
 	s.Go()
 }
+
+// connect opens the database for the named SQL backend
+func connect(backend, dsn string) (*sql.DB, error) {
+	switch backend {
+	case "mysql":
+		return mysql.Connect(dsn)
+	case "postgres":
+		return postgres.Connect(dsn)
+	case "sqlite":
+		return sqlite.Connect(dsn)
+	default:
+		return nil, fmt.Errorf("unknown datastore %q", backend)
+	}
+}
+
+// connectRedis connects to the configured redis server, starting an
+// in-process fake if its address is "fake". Each command is given at most
+// timeout.
+func connectRedis(cfg config.Redis, timeout time.Duration) (*redis.Client, error) {
+	addr := cfg.Addr
+	if addr == "fake" {
+		f, err := redis.NewFake()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Using a fake redis at %v, which is lost on exit and not shared", f.Addr())
+		addr = f.Addr()
+	}
+
+	rc := redis.New(addr, cfg.Password, cfg.DB, timeout)
+	if err := rc.Ping(context.Background()); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// newDatastore creates the named datastore backend. db is nil for memory.
+func newDatastore(backend string, db *sql.DB) (datastore.Datastore, error) {
+	switch backend {
+	case "memory":
+		return datastore.NewMemory(), nil
+	case "mysql":
+		return datastore.New(db)
+	case "postgres":
+		return datastore.NewPostgres(db)
+	case "sqlite":
+		return datastore.NewSQLite(db)
+	default:
+		return nil, fmt.Errorf("unknown datastore %q", backend)
+	}
+}
+
+// migrateUp applies any pending migrations, logging what was done
+func migrateUp(ctx context.Context, db *sql.DB, dialect string) error {
+	m, err := migrations.New(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	done, err := m.Up(ctx)
+	for _, v := range done {
+		log.Printf("Applied migration %04d", v)
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+)
+
+// runSlugs implements the slugs subcommand, used to move existing links over
+// to case insensitive slugs:
+//
+//	shorty slugs check   list slugs that would clash once folded
+//	shorty slugs fold    lower case every slug, if none would clash
+func runSlugs(ds datastore.Datastore, args []string) error {
+	ctx := context.Background()
+
+	if len(args) != 1 {
+		return fmt.Errorf("usage: shorty slugs check|fold")
+	}
+
+	switch args[0] {
+	case "check":
+		n, err := checkSlugs(ctx, ds)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%d groups of slugs would clash", n)
+		}
+		fmt.Fprintln(os.Stderr, "No slugs would clash when folded to lower case.")
+		return nil
+
+	case "fold":
+		n, err := checkSlugs(ctx, ds)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%d groups of slugs would clash, purge all but one of each and try again", n)
+		}
+		changed, err := ds.FoldSlugs(ctx)
+		if err == datastore.ErrSlugTaken {
+			return fmt.Errorf("slugs would clash, a link may have been added meanwhile; try again")
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Folded %d slugs to lower case.\n", changed)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown slugs command %q, want check or fold", args[0])
+	}
+}
+
+// checkSlugs prints each group of slugs that would clash when folded,
+// returning how many there are
+func checkSlugs(ctx context.Context, ds datastore.Datastore) (int, error) {
+	all, err := ds.GetSlugs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	collisions := datastore.FoldCollisions(all)
+	for _, group := range collisions {
+		fmt.Println(strings.Join(group, " "))
+	}
+	return len(collisions), nil
+}
+
+// unfoldedSlugs counts the stored slugs that aren't already folded, which
+// can't be found once slugs are case insensitive
+func unfoldedSlugs(ctx context.Context, ds datastore.Datastore) (int, error) {
+	all, err := ds.GetSlugs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, s := range all {
+		if datastore.FoldSlug(s) != s {
+			n++
+		}
+	}
+	return n, nil
+}
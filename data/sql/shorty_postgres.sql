@@ -0,0 +1,22 @@
+-- Development seed data. Create the schema first with `shorty migrate`.
+
+-- ----------------------------
+-- Records of url
+-- ----------------------------
+BEGIN;
+INSERT INTO url (id, slug, url, created_at) VALUES (1, 'goog', 'https://www.google.ca/', '2018-03-05 04:00:00');
+INSERT INTO url (id, slug, url, created_at) VALUES (2, 'twitter', 'https://twitter.com/', '2018-03-05 04:00:00');
+INSERT INTO url (id, slug, url, created_at) VALUES (3, 'fb', 'https://www.facebook.com/', '2018-03-05 04:00:00');
+INSERT INTO url (id, slug, url, created_at) VALUES (4, 'yt', 'https://www.youtube.com/', '2018-03-05 04:00:00');
+SELECT setval('url_id_seq', 4);
+COMMIT;
+
+-- ----------------------------
+-- Records of visit
+-- ----------------------------
+BEGIN;
+INSERT INTO visit (id, url_id, device, os, browser, ip, created_at) VALUES (1, 1, 'Other', 'Mac OS X', 'Chrome', '127.0.0.1', '2018-03-05 04:16:06');
+INSERT INTO visit (id, url_id, device, os, browser, ip, created_at) VALUES (2, 1, 'Nexus 5', 'Android', 'Chrome Mobile', '127.0.0.1', '2018-03-05 05:08:38');
+INSERT INTO visit (id, url_id, device, os, browser, ip, created_at) VALUES (3, 1, 'iPhone', 'iOS', 'Chrome Mobile iOS', '127.0.0.1', '2018-03-05 05:08:46');
+SELECT setval('visit_id_seq', 3);
+COMMIT;
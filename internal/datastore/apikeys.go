@@ -0,0 +1,98 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// APIKey models a key allowed to use the server, or the api_key table. Only
+// a hash of the key itself is stored; see passwords.HashToken.
+type APIKey struct {
+	ID        int
+	Name      string
+	Hash      string
+	Admin     bool
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// Scope returns the urls the key may see and change
+func (k *APIKey) Scope() Scope {
+	if k.Admin {
+		return AllURLs
+	}
+	return Scope{APIKeyID: k.ID}
+}
+
+func (ds datastore) SaveAPIKey(ctx context.Context, k *APIKey) error {
+	const query = `INSERT INTO api_key (name, key_hash, admin) VALUES (?, ?, ?)`
+	id, err := ds.dialect.insert(ctx, ds.db, query, k.Name, k.Hash, k.Admin)
+	if err != nil {
+		return err
+	}
+	k.ID = id
+	return nil
+}
+
+func (ds datastore) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	const query = `SELECT id, name, key_hash, admin, created_at, revoked_at FROM api_key WHERE key_hash = ?`
+	row := ds.db.QueryRowContext(ctx, ds.dialect.rebind(query), hash)
+	k, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return k, err
+}
+
+func (ds datastore) GetAPIKeys(ctx context.Context) ([]APIKey, error) {
+	const query = `SELECT id, name, key_hash, admin, created_at, revoked_at FROM api_key ORDER BY id`
+	rows, err := ds.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]APIKey, 0)
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (ds datastore) RevokeAPIKey(ctx context.Context, id int) error {
+	const query = `UPDATE api_key SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL`
+	res, err := ds.db.ExecContext(ctx, ds.dialect.rebind(query), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row scanner) (*APIKey, error) {
+	var k APIKey
+	var revokedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.Name, &k.Hash, &k.Admin, &k.CreatedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	k.RevokedAt = nullTime(revokedAt)
+	return &k, nil
+}
@@ -0,0 +1,273 @@
+package datastore
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache stores the results of GetURLBySlug for Cached. A nil *URLMap
+// records that the slug wasn't found.
+type Cache interface {
+	Get(ctx context.Context, slug string) (u *URLMap, ok bool)
+	Set(ctx context.Context, slug string, u *URLMap, ttl time.Duration)
+	Delete(ctx context.Context, slug string)
+}
+
+// Cached wraps ds so GetURLBySlug is answered from cache when it can. Urls
+// are kept for ttl and unknown slugs for negativeTTL, and forgotten when
+// they are saved, updated, deleted or folded through the wrapper. Urls
+// limited by clicks are never cached, as their click counts must be current.
+//
+// Wrap ds with Cached before FoldCase, so the cache only sees folded slugs,
+// and after WithDeadlines, so a slow cache doesn't use up the datastore's
+// time.
+func Cached(ds Datastore, cache Cache, ttl, negativeTTL time.Duration) Datastore {
+	return cached{ds: ds, cache: cache, ttl: ttl, negativeTTL: negativeTTL}
+}
+
+// cached wraps every method rather than embedding ds, so new ones that
+// change urls can't be added without thinking about the cache
+type cached struct {
+	ds          Datastore
+	cache       Cache
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+func (c cached) GetURLBySlug(ctx context.Context, slug string) (*URLMap, error) {
+	if u, ok := c.cache.Get(ctx, slug); ok {
+		if u == nil {
+			return nil, ErrNotFound
+		}
+		return u, nil
+	}
+
+	u, err := c.ds.GetURLBySlug(ctx, slug)
+	switch {
+	case err == ErrNotFound && c.negativeTTL > 0:
+		c.cache.Set(ctx, slug, nil, c.negativeTTL)
+	case err == nil && u.MaxClicks == 0:
+		c.cache.Set(ctx, slug, u, c.ttl)
+	}
+	return u, err
+}
+
+func (c cached) GetURL(ctx context.Context, slug string, scope Scope) (*URLMap, error) {
+	return c.ds.GetURL(ctx, slug, scope)
+}
+
+func (c cached) SaveNewURL(ctx context.Context, u *URLMap) error {
+	err := c.ds.SaveNewURL(ctx, u)
+	if err == nil {
+		c.cache.Delete(ctx, u.Slug)
+	}
+	return err
+}
+
+func (c cached) SaveNewURLFromID(ctx context.Context, u *URLMap, slugFor func(id int) string) error {
+	err := c.ds.SaveNewURLFromID(ctx, u, slugFor)
+	if err == nil {
+		c.cache.Delete(ctx, u.Slug)
+	}
+	return err
+}
+
+func (c cached) UpdateURL(ctx context.Context, slug string, url string, scope Scope) error {
+	err := c.ds.UpdateURL(ctx, slug, url, scope)
+	if err == nil {
+		c.cache.Delete(ctx, slug)
+	}
+	return err
+}
+
+func (c cached) DeleteURL(ctx context.Context, slug string, mode DeleteMode, scope Scope) error {
+	err := c.ds.DeleteURL(ctx, slug, mode, scope)
+	if err == nil {
+		c.cache.Delete(ctx, slug)
+	}
+	return err
+}
+
+func (c cached) GetSlugs(ctx context.Context) ([]string, error) {
+	return c.ds.GetSlugs(ctx)
+}
+
+// FoldSlugs forgets every slug that may have changed, under both its old
+// and folded spellings, as the folded one may be cached as unknown
+func (c cached) FoldSlugs(ctx context.Context) (int, error) {
+	slugs, err := c.ds.GetSlugs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.ds.FoldSlugs(ctx)
+	if err != nil {
+		return n, err
+	}
+	for _, slug := range slugs {
+		if folded := FoldSlug(slug); folded != slug {
+			c.cache.Delete(ctx, slug)
+			c.cache.Delete(ctx, folded)
+		}
+	}
+	return n, nil
+}
+
+// TrackHits needs no invalidation, as urls limited by clicks aren't cached
+func (c cached) TrackHits(ctx context.Context, hits []Hit) error {
+	return c.ds.TrackHits(ctx, hits)
+}
+
+func (c cached) CountVisits(ctx context.Context, urlID int) (int, error) {
+	return c.ds.CountVisits(ctx, urlID)
+}
+
+func (c cached) ListURLs(ctx context.Context, scope Scope, opts ListOptions) ([]VisitCount, *Cursor, error) {
+	return c.ds.ListURLs(ctx, scope, opts)
+}
+
+func (c cached) GetVisits(ctx context.Context, slug string, scope Scope) (*URLMap, []Visit, error) {
+	return c.ds.GetVisits(ctx, slug, scope)
+}
+
+func (c cached) SaveAPIKey(ctx context.Context, k *APIKey) error {
+	return c.ds.SaveAPIKey(ctx, k)
+}
+
+func (c cached) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	return c.ds.GetAPIKeyByHash(ctx, hash)
+}
+
+func (c cached) GetAPIKeys(ctx context.Context) ([]APIKey, error) {
+	return c.ds.GetAPIKeys(ctx)
+}
+
+func (c cached) RevokeAPIKey(ctx context.Context, id int) error {
+	return c.ds.RevokeAPIKey(ctx, id)
+}
+
+func (c cached) SaveUser(ctx context.Context, u *User) error {
+	return c.ds.SaveUser(ctx, u)
+}
+
+func (c cached) GetUser(ctx context.Context, id int) (*User, error) {
+	return c.ds.GetUser(ctx, id)
+}
+
+func (c cached) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	return c.ds.GetUserByUsername(ctx, username)
+}
+
+func (c cached) SaveSession(ctx context.Context, s *Session) error {
+	return c.ds.SaveSession(ctx, s)
+}
+
+func (c cached) GetSessionByHash(ctx context.Context, hash string) (*Session, error) {
+	return c.ds.GetSessionByHash(ctx, hash)
+}
+
+func (c cached) DeleteSession(ctx context.Context, hash string) error {
+	return c.ds.DeleteSession(ctx, hash)
+}
+
+func (c cached) SaveWorkspace(ctx context.Context, w *Workspace, ownerID int) error {
+	return c.ds.SaveWorkspace(ctx, w, ownerID)
+}
+
+func (c cached) GetWorkspaces(ctx context.Context, userID int) ([]Membership, error) {
+	return c.ds.GetWorkspaces(ctx, userID)
+}
+
+func (c cached) GetMembers(ctx context.Context, workspaceID int) ([]Member, error) {
+	return c.ds.GetMembers(ctx, workspaceID)
+}
+
+func (c cached) SetMember(ctx context.Context, workspaceID, userID int, role Role) error {
+	return c.ds.SetMember(ctx, workspaceID, userID, role)
+}
+
+func (c cached) RemoveMember(ctx context.Context, workspaceID, userID int) error {
+	return c.ds.RemoveMember(ctx, workspaceID, userID)
+}
+
+// lru is an in-process Cache holding the most recently used slugs
+type lru struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *lruEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	slug    string
+	url     *URLMap
+	expires time.Time
+}
+
+// NewLRU returns a Cache holding up to size slugs, forgetting the least
+// recently used first. It is safe for concurrent use.
+func NewLRU(size int) Cache {
+	return &lru{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *lru) Get(ctx context.Context, slug string) (*URLMap, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[slug]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return copyURL(e.url), true
+}
+
+func (c *lru) Set(ctx context.Context, slug string, u *URLMap, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := &lruEntry{slug: slug, url: copyURL(u), expires: time.Now().Add(ttl)}
+	if el, ok := c.entries[slug]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[slug] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *lru) Delete(ctx context.Context, slug string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[slug]; ok {
+		c.remove(el)
+	}
+}
+
+// remove drops an entry. Callers must hold c.mu.
+func (c *lru) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).slug)
+}
+
+// copyURL keeps cached urls safe from callers changing the ones returned
+func copyURL(u *URLMap) *URLMap {
+	if u == nil {
+		return nil
+	}
+	c := *u
+	return &c
+}
@@ -0,0 +1,106 @@
+package datastore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+
+	c.Set(ctx, "a", &URLMap{Slug: "a"}, time.Minute)
+	c.Set(ctx, "b", &URLMap{Slug: "b"}, time.Minute)
+	c.Get(ctx, "a")
+	// b is the least recently used
+	c.Set(ctx, "c", &URLMap{Slug: "c"}, time.Minute)
+	for slug, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := c.Get(ctx, slug); ok != want {
+			t.Errorf("Get(%v) hit = %v, want %v", slug, ok, want)
+		}
+	}
+
+	// Callers can't change what's cached
+	u, _ := c.Get(ctx, "a")
+	u.URL = "https://changed.example/"
+	if u, _ := c.Get(ctx, "a"); u.URL != "" {
+		t.Errorf("cached url changed to %q", u.URL)
+	}
+
+	c.Set(ctx, "brief", nil, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := c.Get(ctx, "brief"); ok {
+		t.Error("Get after the ttl hit")
+	}
+}
+
+func TestCachedInvalidation(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemory()
+	ds := Cached(mem, NewLRU(100), time.Minute, time.Minute)
+
+	lookup := func(slug string) string {
+		u, err := ds.GetURLBySlug(ctx, slug)
+		if err == ErrNotFound {
+			return ""
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.URL
+	}
+
+	// Unknown slugs are cached as such until saved
+	if got := lookup("Mixed"); got != "" {
+		t.Fatalf("lookup of a new slug = %q", got)
+	}
+	if err := ds.SaveNewURL(ctx, &URLMap{Slug: "Mixed", URL: "https://one.example/"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup("Mixed"); got != "https://one.example/" {
+		t.Errorf("lookup after saving = %q", got)
+	}
+
+	if err := ds.UpdateURL(ctx, "Mixed", "https://two.example/", AllURLs); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup("Mixed"); got != "https://two.example/" {
+		t.Errorf("lookup after updating = %q", got)
+	}
+
+	// Folding moves the url to the lower case slug, which was cached as
+	// unknown
+	if got := lookup("mixed"); got != "" {
+		t.Fatalf("lookup of the folded slug before folding = %q", got)
+	}
+	if n, err := ds.FoldSlugs(ctx); err != nil || n != 1 {
+		t.Fatalf("FoldSlugs = %d, %v, want 1", n, err)
+	}
+	if got := lookup("Mixed"); got != "" {
+		t.Errorf("lookup of the old slug after folding = %q, want not found", got)
+	}
+	if got := lookup("mixed"); got != "https://two.example/" {
+		t.Errorf("lookup of the folded slug after folding = %q", got)
+	}
+
+	if err := ds.DeleteURL(ctx, "mixed", KeepVisits, AllURLs); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup("mixed"); got != "" {
+		t.Errorf("lookup after deleting = %q", got)
+	}
+
+	// Urls limited by clicks are always read afresh
+	limited := &URLMap{Slug: "limited", URL: "https://one.example/", MaxClicks: 1}
+	if err := ds.SaveNewURL(ctx, limited); err != nil {
+		t.Fatal(err)
+	}
+	lookup("limited")
+	if err := mem.UpdateURL(ctx, "limited", "https://two.example/", AllURLs); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup("limited"); got != "https://two.example/" {
+		t.Errorf("lookup of a url limited by clicks = %q, want it read afresh", got)
+	}
+}
@@ -2,24 +2,167 @@ package datastore
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+)
+
+// Errors returned by every Datastore implementation, regardless of backend
+var (
+	// ErrSlugTaken is returned when saving a url whose slug is already in use
+	ErrSlugTaken = errors.New("datastore: slug already in use")
+
+	// ErrURLExists is returned when saving a url with Dedupe set if its
+	// owner already has a plain url to the same destination. The url passed
+	// in is set to that one.
+	ErrURLExists = errors.New("datastore: url already exists")
+
+	// ErrNotFound is returned when no url exists for the given slug
+	ErrNotFound = errors.New("datastore: not found")
+
+	// ErrUsernameTaken is returned when saving a user whose username is
+	// already in use
+	ErrUsernameTaken = errors.New("datastore: username already in use")
 
-	"github.com/ua-parser/uap-go/uaparser"
+	// ErrLastOwner is returned when changing or removing a member would
+	// leave their workspace without an owner
+	ErrLastOwner = errors.New("datastore: workspace needs an owner")
+
+	// errRefused is used internally when a slug function refuses an id
+	errRefused = errors.New("datastore: slug refused")
 )
 
 // Datastore is the exported interface for our datastore
 type Datastore interface {
 	// URLs
+	// GetURLBySlug finds a live url for forwarding. It may be answered
+	// from a cache, which leaves out the owner fields and tags.
 	GetURLBySlug(ctx context.Context, slug string) (*URLMap, error)
-	SaveNewURL(ctx context.Context, slug string, url string) error
+	// GetURL finds a live url in scope, with every field loaded. It is
+	// never answered from a cache.
+	GetURL(ctx context.Context, slug string, scope Scope) (*URLMap, error)
+	// SaveNewURL saves a new url, setting u.ID. It returns ErrSlugTaken if
+	// the slug is in use, or ErrURLExists if u.Dedupe found an existing url.
+	SaveNewURL(ctx context.Context, u *URLMap) error
+	// SaveNewURLFromID saves a new url whose slug is made from its id by
+	// slugFor, setting u.ID and u.Slug. If that slug is already taken, or
+	// slugFor returns "" to refuse the id, it returns ErrSlugTaken and the id
+	// is not reused.
+	SaveNewURLFromID(ctx context.Context, u *URLMap, slugFor func(id int) string) error
+	UpdateURL(ctx context.Context, slug string, url string, scope Scope) error
+	DeleteURL(ctx context.Context, slug string, mode DeleteMode, scope Scope) error
+
+	// Slug maintenance. GetSlugs includes deleted urls, whose slugs are
+	// still reserved. FoldSlugs folds every slug with FoldSlug, returning how
+	// many changed, or ErrSlugTaken without changing any if two would clash.
+	GetSlugs(ctx context.Context) ([]string, error)
+	FoldSlugs(ctx context.Context) (int, error)
 
 	// Tracking
-	TrackHit(ctx context.Context, urlID int, client *uaparser.Client, remoteAddress string) error
+	// TrackHits records a batch of visits. The batch fails as a whole if
+	// any hit's url no longer exists.
+	TrackHits(ctx context.Context, hits []Hit) error
+	// CountVisits returns how many visits are recorded for a url
+	CountVisits(ctx context.Context, urlID int) (int, error)
 
 	// Stats
-	GetVisitCounts(ctx context.Context) ([]VisitCount, error)
-	GetVisits(ctx context.Context, slug string) (*URLMap, []Visit, error)
+	// ListURLs returns a page of the urls in scope matching opts, with their
+	// visit counts, and a cursor for the next page or nil if it is the last.
+	// A cursor from a different sort order gives ErrInvalidCursor.
+	ListURLs(ctx context.Context, scope Scope, opts ListOptions) ([]VisitCount, *Cursor, error)
+	GetVisits(ctx context.Context, slug string, scope Scope) (*URLMap, []Visit, error)
+
+	// API keys
+	SaveAPIKey(ctx context.Context, k *APIKey) error
+	GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error)
+	GetAPIKeys(ctx context.Context) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int) error
+
+	// Users
+	SaveUser(ctx context.Context, u *User) error
+	GetUser(ctx context.Context, id int) (*User, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	SaveSession(ctx context.Context, s *Session) error
+	GetSessionByHash(ctx context.Context, hash string) (*Session, error)
+	DeleteSession(ctx context.Context, hash string) error
+
+	// Workspaces
+	SaveWorkspace(ctx context.Context, w *Workspace, ownerID int) error
+	GetWorkspaces(ctx context.Context, userID int) ([]Membership, error)
+	GetMembers(ctx context.Context, workspaceID int) ([]Member, error)
+	// SetMember and RemoveMember return ErrLastOwner, changing nothing,
+	// rather than leave a workspace without an owner
+	SetMember(ctx context.Context, workspaceID, userID int, role Role) error
+	RemoveMember(ctx context.Context, workspaceID, userID int) error
+}
+
+// Scope limits which urls an operation may see or change. Urls outside the
+// scope are treated as if they don't exist.
+type Scope struct {
+	// All allows every url, for admins or when authentication is off
+	All bool
+
+	// APIKeyID allows the urls created with that API key
+	APIKeyID int
+
+	// UserID allows the urls created by that user, outside any workspace
+	UserID int
+
+	// WorkspaceIDs allows the urls in those workspaces
+	WorkspaceIDs []int
+}
+
+// AllURLs is the Scope that allows every url
+var AllURLs = Scope{All: true}
+
+// Allows reports whether u is within the scope
+func (sc Scope) Allows(u *URLMap) bool {
+	if sc.All || (sc.APIKeyID != 0 && u.APIKeyID == sc.APIKeyID) {
+		return true
+	}
+	if u.WorkspaceID == 0 {
+		return sc.UserID != 0 && u.UserID == sc.UserID
+	}
+	for _, id := range sc.WorkspaceIDs {
+		if id == u.WorkspaceID {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns a condition on the url table restricting it to the scope,
+// to be ANDed into a WHERE clause, and its arguments
+func (sc Scope) filter() (string, []interface{}) {
+	if sc.All {
+		return "1 = 1", nil
+	}
+
+	var conds []string
+	var args []interface{}
+	if sc.APIKeyID != 0 {
+		conds = append(conds, "api_key_id = ?")
+		args = append(args, sc.APIKeyID)
+	}
+	if sc.UserID != 0 {
+		conds = append(conds, "(workspace_id IS NULL AND account_id = ?)")
+		args = append(args, sc.UserID)
+	}
+	if len(sc.WorkspaceIDs) > 0 {
+		conds = append(conds, "workspace_id IN (?"+strings.Repeat(", ?", len(sc.WorkspaceIDs)-1)+")")
+		for _, id := range sc.WorkspaceIDs {
+			args = append(args, id)
+		}
+	}
+	if len(conds) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
 }
 
 // URLMap models our basic short url to long url relationship, or the url table
@@ -27,8 +170,61 @@ type URLMap struct {
 	ID   int
 	Slug string
 	URL  string
+
+	// ExpiresAt is when the url stops redirecting, or nil for never
+	ExpiresAt *time.Time
+	// MaxClicks is how many visits the url allows, or 0 for unlimited
+	MaxClicks int
+	// Clicks is the number of visits so far. It is only loaded when
+	// MaxClicks is set, and ignored when saving.
+	Clicks int
+
+	// PasswordHash, if set, is the hash of the password needed to follow
+	// the url. See the passwords package.
+	PasswordHash string
+
+	// APIKeyID is the API key that created, and so owns, the url, or 0
+	APIKeyID int
+	// UserID is the user that created, and so owns, the url, or 0
+	UserID int
+	// WorkspaceID is the workspace the url belongs to, or 0. Urls in a
+	// workspace are shared by its members rather than owned by their
+	// creator.
+	WorkspaceID int
+
+	// Dedupe asks SaveNewURL and SaveNewURLFromID to return the owner's
+	// existing plain url to the same destination, if there is one, rather
+	// than save another. Plain urls have no limits, password or tags; Dedupe
+	// is ignored on others.
+	Dedupe bool
+
+	// CreatedAt is when the url was saved. It is set when saving.
+	CreatedAt time.Time
+	// Tags label the url for filtering listings, and must be distinct.
+	// They are saved with the url, but only loaded by ListURLs.
+	Tags []string
+}
+
+// Expired reports whether the url has passed its expiry time or click limit
+func (u *URLMap) Expired(now time.Time) bool {
+	if u.ExpiresAt != nil && !now.Before(*u.ExpiresAt) {
+		return true
+	}
+	return u.MaxClicks > 0 && u.Clicks >= u.MaxClicks
 }
 
+// DeleteMode says what happens to a url's visit history when it is deleted
+type DeleteMode int
+
+const (
+	// KeepVisits stops the url resolving but keeps it and its visits in the
+	// datastore. The slug stays reserved and can't be reused.
+	KeepVisits DeleteMode = iota
+
+	// PurgeVisits removes the url and all of its visits, freeing the slug
+	PurgeVisits
+)
+
 // Visit models a single visit record for a short url
 type Visit struct {
 	ID      int
@@ -39,86 +235,410 @@ type Visit struct {
 	Time    time.Time
 }
 
+// Hit is a visit to a short url waiting to be recorded
+type Hit struct {
+	URLID   int
+	Device  string
+	OS      string
+	Browser string
+	IP      string
+	Time    time.Time
+}
+
 // VisitCount models aggregate visit data for a short url
 type VisitCount struct {
-	Slug  string
-	URL   string
-	Count int
+	ID        int
+	Slug      string
+	URL       string
+	Count     int
+	ExpiresAt *time.Time
+	MaxClicks int
+	// Protected is true if the url needs a password
+	Protected bool
+	// WorkspaceID is the workspace the url belongs to, or 0
+	WorkspaceID int
+	// CreatedAt is when the url was saved, or nil if that isn't known
+	CreatedAt *time.Time
+	Tags      []string
 }
 
 type datastore struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect dialect
 }
 
-// New creates a new Datastore, given a database connection
+// New creates a new Datastore, given a MySQL database connection
 func New(db *sql.DB) (Datastore, error) {
 	ds := datastore{
-		db: db,
+		db:      db,
+		dialect: mysqlDialect,
+	}
+	return ds, nil
+}
+
+// NewPostgres creates a new Datastore, given a PostgreSQL database connection
+func NewPostgres(db *sql.DB) (Datastore, error) {
+	ds := datastore{
+		db:      db,
+		dialect: postgresDialect,
+	}
+	return ds, nil
+}
+
+// NewSQLite creates a new Datastore, given a SQLite database connection
+func NewSQLite(db *sql.DB) (Datastore, error) {
+	ds := datastore{
+		db:      db,
+		dialect: sqliteDialect,
 	}
 	return ds, nil
 }
 
 func (ds datastore) GetURLBySlug(ctx context.Context, slug string) (*URLMap, error) {
 	var url URLMap
+	var expiresAt sql.NullTime
+	var maxClicks sql.NullInt64
+	var passwordHash sql.NullString
+	var apiKeyID, userID, workspaceID sql.NullInt64
+	var createdAt sql.NullTime
 
-	row := ds.db.QueryRow(`SELECT id, slug, url FROM url WHERE slug = ?`, slug)
-	err := row.Scan(&url.ID, &url.Slug, &url.URL)
+	// Only count clicks for urls that are limited by them
+	const query = `SELECT id, slug, url, expires_at, max_clicks,
+		CASE WHEN max_clicks IS NULL THEN 0 ELSE (SELECT COUNT(*) FROM visit WHERE url_id = url.id) END,
+		password_hash, api_key_id, account_id, workspace_id, created_at
+		FROM url WHERE slug = ? AND deleted_at IS NULL`
+	row := ds.db.QueryRowContext(ctx, ds.dialect.rebind(query), slug)
+	err := row.Scan(&url.ID, &url.Slug, &url.URL, &expiresAt, &maxClicks, &url.Clicks, &passwordHash, &apiKeyID, &userID, &workspaceID, &createdAt)
 	if err == sql.ErrNoRows {
-		return &URLMap{}, nil
+		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
+	url.ExpiresAt = nullTime(expiresAt)
+	url.MaxClicks = int(maxClicks.Int64)
+	url.PasswordHash = passwordHash.String
+	url.APIKeyID = int(apiKeyID.Int64)
+	url.UserID = int(userID.Int64)
+	url.WorkspaceID = int(workspaceID.Int64)
+	url.CreatedAt = createdAt.Time
 
 	return &url, nil
 }
 
-func (ds datastore) SaveNewURL(ctx context.Context, slug string, url string) error {
-	_, err := ds.db.Exec(`INSERT INTO url (slug, url) VALUES (?, ?)`, slug, url)
-	return err
+func (ds datastore) GetURL(ctx context.Context, slug string, scope Scope) (*URLMap, error) {
+	u, err := ds.GetURLBySlug(ctx, slug)
+	if err == nil && !scope.Allows(u) {
+		return nil, ErrNotFound
+	}
+	return u, err
+}
+
+// plain reports whether u can be deduplicated: it has no limits, password
+// or tags
+func (u *URLMap) plain() bool {
+	return u.ExpiresAt == nil && u.MaxClicks == 0 && u.PasswordHash == "" && len(u.Tags) == 0
+}
+
+// dedupeKey identifies u by its owner and destination, for the unique index
+// that stops concurrent saves deduplicating u from creating two urls
+func dedupeKey(u *URLMap) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%d %d %d %s", u.APIKeyID, u.UserID, u.WorkspaceID, u.URL)))
+	return hex.EncodeToString(h[:])
 }
 
-func (ds datastore) TrackHit(ctx context.Context, urlID int, client *uaparser.Client, remoteAddress string) error {
-	const query = `INSERT INTO visit (url_id, device, os, browser, ip) VALUES (?, ?, ?, ?, ?)`
-	_, err := ds.db.Exec(query, urlID, client.Device.Family, client.Os.Family, client.UserAgent.Family, remoteAddress)
-	return err
+// findPlain finds a live plain url with the same owner and destination as
+// u. Urls saved before dedupe keys, or without one, are found too.
+func (ds datastore) findPlain(ctx context.Context, db execer, u *URLMap) (*URLMap, error) {
+	const query = `SELECT id, slug, url, created_at FROM url
+		WHERE url = ? AND deleted_at IS NULL
+		AND expires_at IS NULL AND max_clicks IS NULL AND password_hash IS NULL
+		AND COALESCE(api_key_id, 0) = ? AND COALESCE(account_id, 0) = ? AND COALESCE(workspace_id, 0) = ?
+		AND NOT EXISTS (SELECT 1 FROM url_tag t WHERE t.url_id = url.id)
+		ORDER BY id LIMIT 1`
+	return scanPlain(u, db.QueryRowContext(ctx, ds.dialect.rebind(query), u.URL, u.APIKeyID, u.UserID, u.WorkspaceID))
 }
 
-func (ds datastore) GetVisitCounts(ctx context.Context) ([]VisitCount, error) {
-	vc := make([]VisitCount, 0)
+// findDedupeKey finds the live url saved with u's dedupe key
+func (ds datastore) findDedupeKey(ctx context.Context, u *URLMap) (*URLMap, error) {
+	const query = `SELECT id, slug, url, created_at FROM url WHERE dedupe_key = ? AND deleted_at IS NULL`
+	return scanPlain(u, ds.db.QueryRowContext(ctx, ds.dialect.rebind(query), dedupeKey(u)))
+}
 
-	const query = `SELECT slug, url, COALESCE(cnt, 0) FROM url u LEFT JOIN ( SELECT url_id, COUNT(*) cnt FROM visit GROUP BY url_id ) v ON v.url_id = u.id ORDER BY id`
-	rows, err := ds.db.Query(query)
+// scanPlain reads a url found by findPlain or findDedupeKey, owned as u is
+func scanPlain(u *URLMap, row *sql.Row) (*URLMap, error) {
+	found := URLMap{APIKeyID: u.APIKeyID, UserID: u.UserID, WorkspaceID: u.WorkspaceID}
+	var createdAt sql.NullTime
+	err := row.Scan(&found.ID, &found.Slug, &found.URL, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
+	found.CreatedAt = createdAt.Time
+	return &found, nil
+}
 
-	for rows.Next() {
-		var v VisitCount
-		err = rows.Scan(&v.Slug, &v.URL, &v.Count)
+// duplicate explains a unique key violation saving u, after its
+// transaction has been rolled back: either another save with the same
+// dedupe key won, or the slug is taken
+func (ds datastore) duplicate(ctx context.Context, u *URLMap) error {
+	if u.Dedupe && u.plain() {
+		found, err := ds.findDedupeKey(ctx, u)
+		if err == nil {
+			*u = *found
+			return ErrURLExists
+		}
+		if err != ErrNotFound {
+			return err
+		}
+	}
+	return ErrSlugTaken
+}
+
+// dedupe looks for an existing url for u to be deduplicated to, inside the
+// transaction saving it. If there is one u is set to it and ErrURLExists
+// returned; otherwise it returns nil.
+func (ds datastore) dedupe(ctx context.Context, tx *sql.Tx, u *URLMap) error {
+	if !u.Dedupe || !u.plain() {
+		return nil
+	}
+	found, err := ds.findPlain(ctx, tx, u)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	*u = *found
+	return ErrURLExists
+}
+
+func (ds datastore) SaveNewURL(ctx context.Context, u *URLMap) error {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ds.dedupe(ctx, tx, u); err != nil {
+		return err
+	}
+	id, err := ds.insertURL(ctx, tx, u)
+	if ds.dialect.isDuplicateKey(err) {
+		tx.Rollback()
+		return ds.duplicate(ctx, u)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	u.ID = id
+	return nil
+}
+
+func (ds datastore) SaveNewURLFromID(ctx context.Context, u *URLMap, slugFor func(id int) string) error {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ds.dedupe(ctx, tx, u); err != nil {
+		return err
+	}
+
+	// The row needs a unique slug until its id is known. '!' never appears
+	// in real slugs, and nobody else can see the row before it's updated.
+	tmp := *u
+	tmp.Slug = "!" + rand.Text()
+	id, err := ds.insertURL(ctx, tx, &tmp)
+	if ds.dialect.isDuplicateKey(err) {
+		// Only the dedupe key can clash
+		tx.Rollback()
+		return ds.duplicate(ctx, u)
+	}
+	if err != nil {
+		return err
+	}
+
+	slug := slugFor(id)
+	if slug == "" {
+		err = errRefused
+	} else {
+		const query = `UPDATE url SET slug = ? WHERE id = ?`
+		_, err = tx.ExecContext(ctx, ds.dialect.rebind(query), slug, id)
+	}
+	if err == errRefused || ds.dialect.isDuplicateKey(err) {
+		// Rolling back would let SQLite hand out the same id again, so
+		// delete the row and commit to use the id up
+		const del = `DELETE FROM url WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, ds.dialect.rebind(del), id); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return ErrSlugTaken
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	u.ID, u.Slug, u.CreatedAt = id, slug, tmp.CreatedAt
+	return nil
+}
+
+// insertURL inserts a row for u into the url table, and its tags into
+// url_tag, returning its id and setting u.CreatedAt
+func (ds datastore) insertURL(ctx context.Context, db execer, u *URLMap) (int, error) {
+	var expiresAt, maxClicks, passwordHash, apiKeyID, userID, workspaceID, key interface{}
+	if u.ExpiresAt != nil {
+		expiresAt = u.ExpiresAt.UTC()
+	}
+	if u.MaxClicks > 0 {
+		maxClicks = u.MaxClicks
+	}
+	if u.PasswordHash != "" {
+		passwordHash = u.PasswordHash
+	}
+	if u.APIKeyID != 0 {
+		apiKeyID = u.APIKeyID
+	}
+	if u.UserID != 0 {
+		userID = u.UserID
+	}
+	if u.WorkspaceID != 0 {
+		workspaceID = u.WorkspaceID
+	}
+	if u.Dedupe && u.plain() {
+		key = dedupeKey(u)
+	}
+
+	// Set explicitly, as SQLite's column has no default
+	createdAt := time.Now().UTC().Truncate(time.Second)
+
+	const query = `INSERT INTO url (slug, url, expires_at, max_clicks, password_hash, api_key_id, account_id, workspace_id, dedupe_key, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	id, err := ds.dialect.insert(ctx, db, query, u.Slug, u.URL, expiresAt, maxClicks, passwordHash, apiKeyID, userID, workspaceID, key, createdAt)
+	if err != nil {
+		return 0, err
+	}
+
+	const tagQuery = `INSERT INTO url_tag (url_id, tag) VALUES (?, ?)`
+	for _, tag := range u.Tags {
+		if _, err := db.ExecContext(ctx, ds.dialect.rebind(tagQuery), id, tag); err != nil {
+			return 0, err
+		}
+	}
+	u.CreatedAt = createdAt
+	return id, nil
+}
+
+func (ds datastore) UpdateURL(ctx context.Context, slug string, url string, scope Scope) error {
+	filter, args := scope.filter()
+	// The dedupe key no longer matches, so it's dropped
+	query := `UPDATE url SET url = ?, dedupe_key = NULL WHERE slug = ? AND deleted_at IS NULL AND ` + filter
+	res, err := ds.db.ExecContext(ctx, ds.dialect.rebind(query), append([]interface{}{url, slug}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// MySQL counts only changed rows, so check the url exists rather
+		// than being set to its current value
+		u, err := ds.GetURLBySlug(ctx, slug)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if !scope.Allows(u) {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
+
+func (ds datastore) DeleteURL(ctx context.Context, slug string, mode DeleteMode, scope Scope) error {
+	filter, args := scope.filter()
+	// Dropping the dedupe key lets a new url to the destination be saved
+	query := `UPDATE url SET deleted_at = CURRENT_TIMESTAMP, dedupe_key = NULL WHERE slug = ? AND deleted_at IS NULL AND ` + filter
+	if mode == PurgeVisits {
+		// Visits go with it, via ON DELETE CASCADE
+		query = `DELETE FROM url WHERE slug = ? AND ` + filter
+	}
+
+	res, err := ds.db.ExecContext(ctx, ds.dialect.rebind(query), append([]interface{}{slug}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// maxHitsPerInsert keeps multi-row inserts well inside every database's
+// limit on placeholders in one statement
+const maxHitsPerInsert = 500
+
+func (ds datastore) TrackHits(ctx context.Context, hits []Hit) error {
+	for len(hits) > 0 {
+		n := len(hits)
+		if n > maxHitsPerInsert {
+			n = maxHitsPerInsert
 		}
 
-		vc = append(vc, v)
+		query := `INSERT INTO visit (url_id, device, os, browser, ip, created_at) VALUES ` +
+			strings.TrimSuffix(strings.Repeat(`(?, ?, ?, ?, ?, ?), `, n), `, `)
+		args := make([]interface{}, 0, n*6)
+		for _, h := range hits[:n] {
+			args = append(args, h.URLID, h.Device, h.OS, h.Browser, h.IP, h.Time.UTC().Truncate(time.Second))
+		}
+		if _, err := ds.db.ExecContext(ctx, ds.dialect.rebind(query), args...); err != nil {
+			return err
+		}
+		hits = hits[n:]
 	}
+	return nil
+}
 
-	return vc, nil
+func (ds datastore) CountVisits(ctx context.Context, urlID int) (int, error) {
+	const query = `SELECT COUNT(*) FROM visit WHERE url_id = ?`
+	var n int
+	err := ds.db.QueryRowContext(ctx, ds.dialect.rebind(query), urlID).Scan(&n)
+	return n, err
 }
 
-func (ds datastore) GetVisits(ctx context.Context, slug string) (*URLMap, []Visit, error) {
+func (ds datastore) GetVisits(ctx context.Context, slug string, scope Scope) (*URLMap, []Visit, error) {
 	url, err := ds.GetURLBySlug(ctx, slug)
 	if err != nil {
 		return nil, nil, err
 	}
+	if !scope.Allows(url) {
+		return nil, nil, ErrNotFound
+	}
 
 	visits := make([]Visit, 0)
 	const query = `SELECT id, device, os, browser, ip, created_at FROM visit WHERE url_id = ? ORDER BY id DESC`
 
-	rows, err := ds.db.Query(query, url.ID)
+	rows, err := ds.db.QueryContext(ctx, ds.dialect.rebind(query), url.ID)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var v Visit
@@ -129,6 +649,17 @@ func (ds datastore) GetVisits(ctx context.Context, slug string) (*URLMap, []Visi
 
 		visits = append(visits, v)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
 
 	return url, visits, nil
 }
+
+// nullTime converts a nullable column value to a *time.Time
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
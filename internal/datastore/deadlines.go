@@ -0,0 +1,260 @@
+package datastore
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TimeoutError is returned when an operation runs past its deadline
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return "datastore: timed out: " + e.Err.Error()
+}
+
+// Timeout is true, as for net.Error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// UnavailableError is returned when the database can't be reached
+type UnavailableError struct {
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	return "datastore: unavailable: " + e.Err.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// WithDeadlines wraps ds so every operation gets at most timeout, on top of
+// any deadline the caller's context already has, and so running out of
+// time or failing to reach the database are returned as a *TimeoutError or
+// *UnavailableError. Other errors, like ErrNotFound, are returned as is.
+func WithDeadlines(ds Datastore, timeout time.Duration) Datastore {
+	return deadlines{ds: ds, timeout: timeout}
+}
+
+// deadlines wraps every method rather than embedding ds, so new ones can't
+// be added without a deadline
+type deadlines struct {
+	ds      Datastore
+	timeout time.Duration
+}
+
+func (d deadlines) op(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, d.timeout)
+}
+
+// check types err, made while running with ctx
+func (d deadlines) check(ctx context.Context, err error) error {
+	var ne net.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded:
+		// Drivers don't always wrap the context's error, so check it too
+		return &TimeoutError{Err: err}
+	case errors.Is(err, context.Canceled):
+		// The caller gave up, so there's nobody to tell
+		return err
+	case errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn):
+		return &UnavailableError{Err: err}
+	case errors.As(err, &ne):
+		if ne.Timeout() {
+			return &TimeoutError{Err: err}
+		}
+		return &UnavailableError{Err: err}
+	}
+	return err
+}
+
+func (d deadlines) GetURLBySlug(ctx context.Context, slug string) (*URLMap, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.GetURLBySlug(ctx, slug)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) SaveNewURL(ctx context.Context, u *URLMap) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.SaveNewURL(ctx, u))
+}
+
+func (d deadlines) GetURL(ctx context.Context, slug string, scope Scope) (*URLMap, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.GetURL(ctx, slug, scope)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) SaveNewURLFromID(ctx context.Context, u *URLMap, slugFor func(id int) string) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.SaveNewURLFromID(ctx, u, slugFor))
+}
+
+func (d deadlines) UpdateURL(ctx context.Context, slug string, url string, scope Scope) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.UpdateURL(ctx, slug, url, scope))
+}
+
+func (d deadlines) DeleteURL(ctx context.Context, slug string, mode DeleteMode, scope Scope) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.DeleteURL(ctx, slug, mode, scope))
+}
+
+func (d deadlines) GetSlugs(ctx context.Context) ([]string, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.GetSlugs(ctx)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) FoldSlugs(ctx context.Context) (int, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.FoldSlugs(ctx)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) TrackHits(ctx context.Context, hits []Hit) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.TrackHits(ctx, hits))
+}
+
+func (d deadlines) CountVisits(ctx context.Context, urlID int) (int, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.CountVisits(ctx, urlID)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) ListURLs(ctx context.Context, scope Scope, opts ListOptions) ([]VisitCount, *Cursor, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v1, v2, err := d.ds.ListURLs(ctx, scope, opts)
+	return v1, v2, d.check(ctx, err)
+}
+
+func (d deadlines) GetVisits(ctx context.Context, slug string, scope Scope) (*URLMap, []Visit, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v1, v2, err := d.ds.GetVisits(ctx, slug, scope)
+	return v1, v2, d.check(ctx, err)
+}
+
+func (d deadlines) SaveAPIKey(ctx context.Context, k *APIKey) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.SaveAPIKey(ctx, k))
+}
+
+func (d deadlines) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.GetAPIKeyByHash(ctx, hash)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) GetAPIKeys(ctx context.Context) ([]APIKey, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.GetAPIKeys(ctx)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) RevokeAPIKey(ctx context.Context, id int) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.RevokeAPIKey(ctx, id))
+}
+
+func (d deadlines) SaveUser(ctx context.Context, u *User) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.SaveUser(ctx, u))
+}
+
+func (d deadlines) GetUser(ctx context.Context, id int) (*User, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.GetUser(ctx, id)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.GetUserByUsername(ctx, username)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) SaveSession(ctx context.Context, s *Session) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.SaveSession(ctx, s))
+}
+
+func (d deadlines) GetSessionByHash(ctx context.Context, hash string) (*Session, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.GetSessionByHash(ctx, hash)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) DeleteSession(ctx context.Context, hash string) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.DeleteSession(ctx, hash))
+}
+
+func (d deadlines) SaveWorkspace(ctx context.Context, w *Workspace, ownerID int) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.SaveWorkspace(ctx, w, ownerID))
+}
+
+func (d deadlines) GetWorkspaces(ctx context.Context, userID int) ([]Membership, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.GetWorkspaces(ctx, userID)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) GetMembers(ctx context.Context, workspaceID int) ([]Member, error) {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	v, err := d.ds.GetMembers(ctx, workspaceID)
+	return v, d.check(ctx, err)
+}
+
+func (d deadlines) SetMember(ctx context.Context, workspaceID, userID int, role Role) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.SetMember(ctx, workspaceID, userID, role))
+}
+
+func (d deadlines) RemoveMember(ctx context.Context, workspaceID, userID int) error {
+	ctx, cancel := d.op(ctx)
+	defer cancel()
+	return d.check(ctx, d.ds.RemoveMember(ctx, workspaceID, userID))
+}
@@ -0,0 +1,121 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testDedupe checks saving with Dedupe returns the owner's existing plain
+// url, including when saves race
+func testDedupe(t *testing.T, ds Datastore) {
+	ctx := context.Background()
+
+	alice, bob := &User{Username: "alice"}, &User{Username: "bob"}
+	for _, u := range []*User{alice, bob} {
+		if err := ds.SaveUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := &APIKey{Name: "key", Hash: "hash"}
+	if err := ds.SaveAPIKey(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	first := &URLMap{Slug: "first", URL: "https://example.com/", UserID: alice.ID, Dedupe: true}
+	if err := ds.SaveNewURL(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	again := &URLMap{Slug: "again", URL: "https://example.com/", UserID: alice.ID, Dedupe: true}
+	if err := ds.SaveNewURL(ctx, again); err != ErrURLExists {
+		t.Fatalf("saving the same url again = %v, want ErrURLExists", err)
+	}
+	if again.ID != first.ID || again.Slug != "first" {
+		t.Errorf("saving the same url again gave %+v, want first", again)
+	}
+	fromID := &URLMap{URL: "https://example.com/", UserID: alice.ID, Dedupe: true}
+	if err := ds.SaveNewURLFromID(ctx, fromID, func(id int) string { return fmt.Sprint("id", id) }); err != ErrURLExists || fromID.Slug != "first" {
+		t.Errorf("SaveNewURLFromID of the same url = %v, %+v, want first", err, fromID)
+	}
+
+	// Other owners, urls with limits, and saves without Dedupe get their
+	// own
+	expires := time.Now().Add(time.Hour)
+	for _, u := range []*URLMap{
+		{Slug: "other-owner", URL: "https://example.com/", UserID: bob.ID, Dedupe: true},
+		{Slug: "api-key", URL: "https://example.com/", APIKeyID: key.ID, Dedupe: true},
+		{Slug: "expiring", URL: "https://example.com/", UserID: alice.ID, ExpiresAt: &expires, Dedupe: true},
+		{Slug: "tagged", URL: "https://example.com/", UserID: alice.ID, Tags: []string{"t"}, Dedupe: true},
+		{Slug: "forced", URL: "https://example.com/", UserID: alice.ID},
+	} {
+		if err := ds.SaveNewURL(ctx, u); err != nil {
+			t.Errorf("saving %v = %v", u.Slug, err)
+		}
+	}
+	// A url with a limit isn't reused either
+	limited := &URLMap{Slug: "limited", URL: "https://limited.example/", UserID: alice.ID, MaxClicks: 5}
+	if err := ds.SaveNewURL(ctx, limited); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.SaveNewURL(ctx, &URLMap{Slug: "unlimited", URL: "https://limited.example/", UserID: alice.ID, Dedupe: true}); err != nil {
+		t.Errorf("saving a url whose only match is limited = %v", err)
+	}
+
+	// A deleted url isn't reused
+	if err := ds.DeleteURL(ctx, "first", KeepVisits, AllURLs); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.DeleteURL(ctx, "forced", KeepVisits, AllURLs); err != nil {
+		t.Fatal(err)
+	}
+	replaced := &URLMap{Slug: "replaced", URL: "https://example.com/", UserID: alice.ID, Dedupe: true}
+	if err := ds.SaveNewURL(ctx, replaced); err != nil {
+		t.Fatalf("saving after deleting = %v", err)
+	}
+	// Nor one that now points elsewhere
+	if err := ds.UpdateURL(ctx, "replaced", "https://elsewhere.example/", AllURLs); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.SaveNewURL(ctx, &URLMap{Slug: "after-update", URL: "https://example.com/", UserID: alice.ID, Dedupe: true}); err != nil {
+		t.Errorf("saving after updating = %v", err)
+	}
+
+	// Racing saves all end up with one url
+	const workers = 10
+	var wg sync.WaitGroup
+	slugs := make([]string, workers)
+	errs := make([]error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u := &URLMap{Slug: fmt.Sprint("race", i), URL: "https://race.example/", UserID: alice.ID, Dedupe: true}
+			errs[i] = ds.SaveNewURL(ctx, u)
+			slugs[i] = u.Slug
+		}(i)
+	}
+	wg.Wait()
+	saved := 0
+	for i := range errs {
+		switch errs[i] {
+		case nil:
+			saved++
+		case ErrURLExists:
+		default:
+			t.Errorf("racing save = %v", errs[i])
+		}
+		if slugs[i] != slugs[0] {
+			t.Errorf("racing saves got %v and %v", slugs[0], slugs[i])
+		}
+	}
+	if saved != 1 {
+		t.Errorf("%d racing saves created a url, want 1", saved)
+	}
+}
+
+func TestMemoryDedupe(t *testing.T) {
+	testDedupe(t, NewMemory())
+}
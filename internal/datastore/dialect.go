@@ -0,0 +1,90 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// dialect captures the differences between the SQL databases we support.
+// Queries are written with ? placeholders and rebound before use.
+type dialect struct {
+	// rebind rewrites ? placeholders into the form the driver expects
+	rebind func(query string) string
+
+	// isDuplicateKey reports whether err is a unique key violation
+	isDuplicateKey func(err error) bool
+
+	// returning is true if the database doesn't support LastInsertId, so
+	// new ids have to be fetched with INSERT ... RETURNING id
+	returning bool
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insert runs an INSERT query, returning the id of the new row
+func (d dialect) insert(ctx context.Context, db execer, query string, args ...interface{}) (int, error) {
+	if d.returning {
+		var id int
+		err := db.QueryRowContext(ctx, d.rebind(query+` RETURNING id`), args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := db.ExecContext(ctx, d.rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+var mysqlDialect = dialect{
+	rebind: func(query string) string { return query },
+	isDuplicateKey: func(err error) bool {
+		me, ok := err.(*mysql.MySQLError)
+		return ok && me.Number == 1062
+	},
+}
+
+var sqliteDialect = dialect{
+	rebind: func(query string) string { return query },
+	isDuplicateKey: func(err error) bool {
+		// The sqlite driver is only linked in with -tags sqlite, so we can't
+		// inspect its error type here.
+		return err != nil && strings.HasPrefix(err.Error(), "UNIQUE constraint failed")
+	},
+}
+
+var postgresDialect = dialect{
+	rebind:    dollarPlaceholders,
+	returning: true,
+	isDuplicateKey: func(err error) bool {
+		// Both lib/pq and pgx errors expose the SQLSTATE code this way
+		se, ok := err.(interface{ SQLState() string })
+		return ok && se.SQLState() == "23505" // unique_violation
+	},
+}
+
+// dollarPlaceholders rewrites ? placeholders as $1, $2, ... Our queries never
+// contain a literal ?, so no attempt is made to skip quoted strings.
+func dollarPlaceholders(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String()
+}
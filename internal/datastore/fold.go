@@ -0,0 +1,137 @@
+package datastore
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// FoldSlug returns the form slugs are stored and looked up in when they are
+// case insensitive
+func FoldSlug(slug string) string {
+	return strings.ToLower(slug)
+}
+
+// FoldCase wraps ds so slugs are case insensitive: they are folded with
+// FoldSlug whenever urls are saved or looked up. Any slugs already stored
+// must be folded first with FoldSlugs, or they can't be found.
+func FoldCase(ds Datastore) Datastore {
+	return foldCase{ds}
+}
+
+type foldCase struct {
+	Datastore
+}
+
+func (f foldCase) GetURLBySlug(ctx context.Context, slug string) (*URLMap, error) {
+	return f.Datastore.GetURLBySlug(ctx, FoldSlug(slug))
+}
+
+func (f foldCase) GetURL(ctx context.Context, slug string, scope Scope) (*URLMap, error) {
+	return f.Datastore.GetURL(ctx, FoldSlug(slug), scope)
+}
+
+func (f foldCase) SaveNewURL(ctx context.Context, u *URLMap) error {
+	u.Slug = FoldSlug(u.Slug)
+	return f.Datastore.SaveNewURL(ctx, u)
+}
+
+func (f foldCase) SaveNewURLFromID(ctx context.Context, u *URLMap, slugFor func(id int) string) error {
+	return f.Datastore.SaveNewURLFromID(ctx, u, func(id int) string {
+		return FoldSlug(slugFor(id))
+	})
+}
+
+func (f foldCase) UpdateURL(ctx context.Context, slug string, url string, scope Scope) error {
+	return f.Datastore.UpdateURL(ctx, FoldSlug(slug), url, scope)
+}
+
+func (f foldCase) DeleteURL(ctx context.Context, slug string, mode DeleteMode, scope Scope) error {
+	return f.Datastore.DeleteURL(ctx, FoldSlug(slug), mode, scope)
+}
+
+func (f foldCase) GetVisits(ctx context.Context, slug string, scope Scope) (*URLMap, []Visit, error) {
+	return f.Datastore.GetVisits(ctx, FoldSlug(slug), scope)
+}
+
+// FoldCollisions finds the slugs that would become the same when folded,
+// returning each group of them sorted. A datastore with collisions can't be
+// made case insensitive until all but one slug in each group is removed.
+func FoldCollisions(slugs []string) [][]string {
+	groups := make(map[string][]string)
+	for _, s := range slugs {
+		k := FoldSlug(s)
+		groups[k] = append(groups[k], s)
+	}
+
+	var collisions [][]string
+	for _, g := range groups {
+		if len(g) > 1 {
+			sort.Strings(g)
+			collisions = append(collisions, g)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i][0] < collisions[j][0] })
+	return collisions
+}
+
+func (ds datastore) GetSlugs(ctx context.Context) ([]string, error) {
+	rows, err := ds.db.QueryContext(ctx, `SELECT slug FROM url ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	slugs := make([]string, 0)
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		slugs = append(slugs, s)
+	}
+	return slugs, rows.Err()
+}
+
+func (ds datastore) FoldSlugs(ctx context.Context) (int, error) {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Fold in Go rather than with SQL's LOWER, whose idea of case differs
+	// between databases
+	rows, err := tx.QueryContext(ctx, `SELECT id, slug FROM url`)
+	if err != nil {
+		return 0, err
+	}
+	changed := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var slug string
+		if err := rows.Scan(&id, &slug); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if folded := FoldSlug(slug); folded != slug {
+			changed[id] = folded
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	const query = `UPDATE url SET slug = ? WHERE id = ?`
+	for id, slug := range changed {
+		_, err := tx.ExecContext(ctx, ds.dialect.rebind(query), slug, id)
+		if ds.dialect.isDuplicateKey(err) {
+			return 0, ErrSlugTaken
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(changed), tx.Commit()
+}
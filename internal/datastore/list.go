@@ -0,0 +1,284 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidCursor is returned by ListURLs for a cursor that can't be
+// decoded, or that was made for a different sort order
+var ErrInvalidCursor = errors.New("datastore: invalid cursor")
+
+// Sort is an order urls can be listed in
+type Sort string
+
+// The orders urls can be listed in. Ties are broken by id.
+const (
+	SortCreated Sort = "created"
+	SortSlug    Sort = "slug"
+	SortClicks  Sort = "clicks"
+)
+
+// ListOptions chooses which urls ListURLs returns, and in what order. The
+// zero value lists every url in scope, oldest first.
+type ListOptions struct {
+	Sort Sort
+	Desc bool
+	// Limit is the most urls to return, or 0 for all of them
+	Limit int
+	// Cursor continues the listing from where a previous page ended
+	Cursor *Cursor
+
+	// SlugPrefix only lists urls whose slug starts with it
+	SlugPrefix string
+	// Host only lists urls to that host, which should be normalized. Urls
+	// saved with an international host before hosts were converted to
+	// punycode don't match.
+	Host string
+	// Tag only lists urls with that tag
+	Tag string
+
+	// APIKeyID, UserID and WorkspaceID only list urls with that owner.
+	// Unlike a Scope, UserID matches urls the user created inside
+	// workspaces too.
+	APIKeyID    int
+	UserID      int
+	WorkspaceID int
+}
+
+// Cursor marks the last url of a page, so the next page starts after it
+type Cursor struct {
+	Sort   Sort   `json:"s"`
+	Desc   bool   `json:"d,omitempty"`
+	ID     int    `json:"i"`
+	Slug   string `json:"k,omitempty"`
+	Clicks int    `json:"c,omitempty"`
+}
+
+// cursorAfter returns the cursor for continuing a listing after v
+func cursorAfter(opts ListOptions, v VisitCount) *Cursor {
+	c := &Cursor{Sort: opts.sort(), Desc: opts.Desc, ID: v.ID}
+	switch c.Sort {
+	case SortSlug:
+		c.Slug = v.Slug
+	case SortClicks:
+		c.Clicks = v.Count
+	}
+	return c
+}
+
+// Encode returns the cursor as an opaque string safe to put in a url
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor made by Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// sort returns the order to list in, defaulting to SortCreated
+func (opts ListOptions) sort() Sort {
+	if opts.Sort == "" {
+		return SortCreated
+	}
+	return opts.Sort
+}
+
+// check validates the sort order and that the cursor belongs to it
+func (opts ListOptions) check() error {
+	switch opts.sort() {
+	case SortCreated, SortSlug, SortClicks:
+	default:
+		return errors.New("datastore: unknown sort " + string(opts.Sort))
+	}
+	if opts.Cursor != nil && (opts.Cursor.Sort != opts.sort() || opts.Cursor.Desc != opts.Desc) {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// hostPrefixes returns the ways a url to host can start. Urls saved before
+// they were normalized may have upper case hosts or explicit default ports,
+// so they are compared lower cased.
+func hostPrefixes(host string) []string {
+	var ps []string
+	for _, scheme := range []string{"http://", "https://"} {
+		for _, next := range []string{"/", ":", "?", "#"} {
+			ps = append(ps, scheme+host+next)
+		}
+	}
+	return ps
+}
+
+// hostURLs returns the urls to host with nothing after it, which urls saved
+// before they were normalized may be
+func hostURLs(host string) []string {
+	return []string{"http://" + host, "https://" + host}
+}
+
+func (f foldCase) ListURLs(ctx context.Context, scope Scope, opts ListOptions) ([]VisitCount, *Cursor, error) {
+	opts.SlugPrefix = FoldSlug(opts.SlugPrefix)
+	return f.Datastore.ListURLs(ctx, scope, opts)
+}
+
+func (ds datastore) ListURLs(ctx context.Context, scope Scope, opts ListOptions) ([]VisitCount, *Cursor, error) {
+	if err := opts.check(); err != nil {
+		return nil, nil, err
+	}
+
+	filter, args := scope.filter()
+	where := []string{"u.deleted_at IS NULL", filter}
+
+	// Prefixes are compared with SUBSTR rather than LIKE, which ignores
+	// case in SQLite
+	if opts.SlugPrefix != "" {
+		where = append(where, "SUBSTR(u.slug, 1, ?) = ?")
+		args = append(args, utf8.RuneCountInString(opts.SlugPrefix), opts.SlugPrefix)
+	}
+	if opts.Host != "" {
+		var conds []string
+		for _, p := range hostPrefixes(opts.Host) {
+			conds = append(conds, "LOWER(SUBSTR(u.url, 1, ?)) = ?")
+			args = append(args, utf8.RuneCountInString(p), p)
+		}
+		for _, h := range hostURLs(opts.Host) {
+			conds = append(conds, "LOWER(u.url) = ?")
+			args = append(args, h)
+		}
+		where = append(where, "("+strings.Join(conds, " OR ")+")")
+	}
+	if opts.Tag != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM url_tag t WHERE t.url_id = u.id AND t.tag = ?)")
+		args = append(args, opts.Tag)
+	}
+	if opts.APIKeyID != 0 {
+		where = append(where, "u.api_key_id = ?")
+		args = append(args, opts.APIKeyID)
+	}
+	if opts.UserID != 0 {
+		where = append(where, "u.account_id = ?")
+		args = append(args, opts.UserID)
+	}
+	if opts.WorkspaceID != 0 {
+		where = append(where, "u.workspace_id = ?")
+		args = append(args, opts.WorkspaceID)
+	}
+
+	const count = "COALESCE(v.cnt, 0)"
+	after, dir := ">", "ASC"
+	if opts.Desc {
+		after, dir = "<", "DESC"
+	}
+	var order string
+	switch opts.sort() {
+	case SortCreated:
+		// Ids are handed out in the order urls are created
+		order = "u.id " + dir
+		if c := opts.Cursor; c != nil {
+			where = append(where, "u.id "+after+" ?")
+			args = append(args, c.ID)
+		}
+	case SortSlug:
+		order = "u.slug " + dir
+		if c := opts.Cursor; c != nil {
+			where = append(where, "u.slug "+after+" ?")
+			args = append(args, c.Slug)
+		}
+	case SortClicks:
+		order = count + " " + dir + ", u.id " + dir
+		if c := opts.Cursor; c != nil {
+			where = append(where, "("+count+" "+after+" ? OR ("+count+" = ? AND u.id "+after+" ?))")
+			args = append(args, c.Clicks, c.Clicks, c.ID)
+		}
+	}
+
+	query := `SELECT u.id, u.slug, u.url, ` + count + `, u.expires_at, u.max_clicks, u.password_hash IS NOT NULL, u.workspace_id, u.created_at
+		FROM url u LEFT JOIN ( SELECT url_id, COUNT(*) cnt FROM visit GROUP BY url_id ) v ON v.url_id = u.id
+		WHERE ` + strings.Join(where, " AND ") + ` ORDER BY ` + order
+	if opts.Limit > 0 {
+		// Fetch one more to know if there's another page
+		query += ` LIMIT ?`
+		args = append(args, opts.Limit+1)
+	}
+	rows, err := ds.db.QueryContext(ctx, ds.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	vc := make([]VisitCount, 0)
+	for rows.Next() {
+		var v VisitCount
+		var expiresAt, createdAt sql.NullTime
+		var maxClicks, workspaceID sql.NullInt64
+		err = rows.Scan(&v.ID, &v.Slug, &v.URL, &v.Count, &expiresAt, &maxClicks, &v.Protected, &workspaceID, &createdAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		v.ExpiresAt = nullTime(expiresAt)
+		v.MaxClicks = int(maxClicks.Int64)
+		v.WorkspaceID = int(workspaceID.Int64)
+		v.CreatedAt = nullTime(createdAt)
+
+		vc = append(vc, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if opts.Limit > 0 && len(vc) > opts.Limit {
+		vc = vc[:opts.Limit]
+		next = cursorAfter(opts, vc[len(vc)-1])
+	}
+	if err := ds.loadTags(ctx, vc); err != nil {
+		return nil, nil, err
+	}
+	return vc, next, nil
+}
+
+// loadTags fills in the tags of each url in vc
+func (ds datastore) loadTags(ctx context.Context, vc []VisitCount) error {
+	if len(vc) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int, len(vc))
+	args := make([]interface{}, 0, len(vc))
+	for i, v := range vc {
+		index[v.ID] = i
+		args = append(args, v.ID)
+	}
+	query := `SELECT url_id, tag FROM url_tag WHERE url_id IN (?` + strings.Repeat(", ?", len(vc)-1) + `) ORDER BY tag`
+	rows, err := ds.db.QueryContext(ctx, ds.dialect.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		i := index[id]
+		vc[i].Tags = append(vc[i].Tags, tag)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,52 @@
+//go:build sqlite
+// +build sqlite
+
+package datastore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/dabfleming/shorty/internal/migrations"
+	"github.com/dabfleming/shorty/internal/platform/sqlite"
+)
+
+// newTestSQLite returns a Datastore on a new, migrated SQLite database
+func newTestSQLite(t *testing.T) Datastore {
+	t.Helper()
+	db, err := sqlite.Connect(filepath.Join(t.TempDir(), "shorty.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migrations.New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := NewSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+func TestSQLiteListPages(t *testing.T) {
+	testListPages(t, newTestSQLite(t))
+}
+
+func TestSQLiteListHost(t *testing.T) {
+	testListHost(t, newTestSQLite(t))
+}
+
+func TestSQLiteDedupe(t *testing.T) {
+	testDedupe(t, newTestSQLite(t))
+}
+
+func TestSQLiteLastOwner(t *testing.T) {
+	testLastOwner(t, newTestSQLite(t))
+}
@@ -0,0 +1,178 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// listFixture is a url saved by fillListing, with its visits
+type listFixture struct {
+	id        int
+	slug      string
+	clicks    int
+	protected bool
+}
+
+// fillListing saves urls with clicks that often tie, so paging by clicks
+// has to break ties by id. Slugs aren't in id order, and some urls have a
+// password.
+func fillListing(t *testing.T, ds Datastore) []listFixture {
+	t.Helper()
+	ctx := context.Background()
+	start := time.Date(2018, 3, 5, 4, 0, 0, 0, time.UTC)
+
+	var fs []listFixture
+	var hits []Hit
+	for i := 0; i < 23; i++ {
+		u := &URLMap{Slug: fmt.Sprintf("s%02d", (i*7)%23), URL: fmt.Sprintf("https://example.com/%d", i)}
+		if i%4 == 0 {
+			u.PasswordHash = "hash"
+		}
+		if err := ds.SaveNewURL(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		f := listFixture{id: u.ID, slug: u.Slug, clicks: []int{2, 0, 2, 1, 2, 0}[i%6], protected: u.PasswordHash != ""}
+		for j := 0; j < f.clicks; j++ {
+			hits = append(hits, Hit{URLID: u.ID, Device: "Other", OS: "Other", Browser: "Other", IP: "127.0.0.1", Time: start})
+		}
+		fs = append(fs, f)
+	}
+	if err := ds.TrackHits(ctx, hits); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+// testListPages walks every page of fillListing's urls in each order, with
+// several page sizes, checking each url is listed once and in order
+func testListPages(t *testing.T, ds Datastore) {
+	ctx := context.Background()
+	fs := fillListing(t, ds)
+	protected := make(map[string]bool)
+	for _, f := range fs {
+		protected[f.slug] = f.protected
+	}
+
+	for _, s := range []Sort{SortCreated, SortSlug, SortClicks} {
+		for _, desc := range []bool{false, true} {
+			want := make([]listFixture, len(fs))
+			copy(want, fs)
+			sort.Slice(want, func(i, j int) bool {
+				a, b := want[i], want[j]
+				if desc {
+					a, b = b, a
+				}
+				switch s {
+				case SortSlug:
+					return a.slug < b.slug
+				case SortClicks:
+					if a.clicks != b.clicks {
+						return a.clicks < b.clicks
+					}
+				}
+				return a.id < b.id
+			})
+			var wantSlugs []string
+			for _, f := range want {
+				wantSlugs = append(wantSlugs, f.slug)
+			}
+
+			for _, limit := range []int{1, 2, 5, 23, 50} {
+				name := fmt.Sprintf("%v/desc=%v/limit=%d", s, desc, limit)
+				opts := ListOptions{Sort: s, Desc: desc, Limit: limit}
+				var got []string
+				for page := 0; ; page++ {
+					if page > len(fs) {
+						t.Fatalf("%v: listing never ended", name)
+					}
+					vc, next, err := ds.ListURLs(ctx, AllURLs, opts)
+					if err != nil {
+						t.Fatalf("%v: page %d: %v", name, page, err)
+					}
+					if len(vc) > limit {
+						t.Fatalf("%v: page %d has %d urls", name, page, len(vc))
+					}
+					for _, v := range vc {
+						got = append(got, v.Slug)
+						if v.Protected != protected[v.Slug] {
+							t.Errorf("%v: %v listed with Protected %v", name, v.Slug, v.Protected)
+						}
+					}
+					if next == nil {
+						break
+					}
+					if len(vc) == 0 {
+						t.Fatalf("%v: page %d is empty but has a cursor", name, page)
+					}
+					// Cursors are passed back encoded
+					c, err := DecodeCursor(next.Encode())
+					if err != nil {
+						t.Fatalf("%v: %v", name, err)
+					}
+					opts.Cursor = c
+				}
+				if !reflect.DeepEqual(got, wantSlugs) {
+					t.Errorf("%v: listed %v, want %v", name, got, wantSlugs)
+				}
+			}
+		}
+	}
+
+	// Cursors only continue the listing they came from
+	_, next, err := ds.ListURLs(ctx, AllURLs, ListOptions{Sort: SortClicks, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ds.ListURLs(ctx, AllURLs, ListOptions{Sort: SortSlug, Limit: 2, Cursor: next}); err != ErrInvalidCursor {
+		t.Errorf("ListURLs with another sort's cursor = %v, want ErrInvalidCursor", err)
+	}
+	if _, _, err := ds.ListURLs(ctx, AllURLs, ListOptions{Sort: SortClicks, Desc: true, Limit: 2, Cursor: next}); err != ErrInvalidCursor {
+		t.Errorf("ListURLs with an ascending cursor descending = %v, want ErrInvalidCursor", err)
+	}
+}
+
+// testListHost checks the host filter matches urls however their host was
+// written
+func testListHost(t *testing.T, ds Datastore) {
+	ctx := context.Background()
+	saved := map[string]string{
+		"n1": "https://example.com/",
+		"n2": "http://example.com:8080/a",
+		"o1": "HTTPS://Example.COM/b",
+		"o2": "http://example.com:80/c",
+		"o3": "https://example.com",
+		"o4": "https://example.com?q=1",
+		"x1": "https://example.com.evil/",
+		"x2": "https://sub.example.com/",
+		"x3": "https://other.example/example.com/",
+	}
+	for slug, u := range saved {
+		if err := ds.SaveNewURL(ctx, &URLMap{Slug: slug, URL: u}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vc, _, err := ds.ListURLs(ctx, AllURLs, ListOptions{Sort: SortSlug, Host: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range vc {
+		got = append(got, v.Slug)
+	}
+	if want := []string{"n1", "n2", "o1", "o2", "o3", "o4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("urls to example.com = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryListPages(t *testing.T) {
+	testListPages(t, NewMemory())
+}
+
+func TestMemoryListHost(t *testing.T) {
+	testListHost(t, NewMemory())
+}
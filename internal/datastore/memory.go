@@ -0,0 +1,615 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memory is an in-process Datastore, useful for tests and local development
+// without a database. It is safe for concurrent use.
+type memory struct {
+	mu          sync.RWMutex
+	urls        map[int]URLMap
+	slugs       map[string]int // slug key -> url id
+	deleted     map[int]bool   // soft deleted url ids
+	visits      map[int][]Visit
+	apiKeys     []APIKey
+	users       []User
+	sessions    map[string]Session // token hash -> session
+	workspaces  []Workspace
+	members     map[int]map[int]Role // workspace id -> user id -> role
+	nextURLID   int
+	nextVisitID int
+	nextSessID  int
+}
+
+// NewMemory creates a new, empty in-memory Datastore
+func NewMemory() Datastore {
+	return &memory{
+		urls:     make(map[int]URLMap),
+		slugs:    make(map[string]int),
+		deleted:  make(map[int]bool),
+		visits:   make(map[int][]Visit),
+		sessions: make(map[string]Session),
+		members:  make(map[int]map[int]Role),
+	}
+}
+
+// slugKey mirrors how MySQL compares values in the slug column: utf8_bin is
+// case sensitive, but VARCHAR comparisons ignore trailing spaces.
+func slugKey(slug string) string {
+	return strings.TrimRight(slug, " ")
+}
+
+func (m *memory) GetURLBySlug(ctx context.Context, slug string) (*URLMap, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.live(slug)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	url := m.urls[id]
+	if url.MaxClicks > 0 {
+		url.Clicks = len(m.visits[id])
+	}
+	return &url, nil
+}
+
+func (m *memory) SaveNewURL(ctx context.Context, u *URLMap) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.dedupe(u); err != nil {
+		return err
+	}
+	return m.save(u)
+}
+
+func (m *memory) GetURL(ctx context.Context, slug string, scope Scope) (*URLMap, error) {
+	u, err := m.GetURLBySlug(ctx, slug)
+	if err == nil && !scope.Allows(u) {
+		return nil, ErrNotFound
+	}
+	return u, err
+}
+
+// findPlain finds a live plain url with the same owner and destination as
+// u. Callers must hold m.mu.
+func (m *memory) findPlain(u *URLMap) (*URLMap, bool) {
+	for _, id := range m.urlIDs() {
+		e := m.urls[id]
+		if m.deleted[id] || e.URL != u.URL || !e.plain() {
+			continue
+		}
+		if e.APIKeyID == u.APIKeyID && e.UserID == u.UserID && e.WorkspaceID == u.WorkspaceID {
+			return &e, true
+		}
+	}
+	return nil, false
+}
+
+// dedupe sets u to the url it should be deduplicated to, returning
+// ErrURLExists, if there is one. Callers must hold m.mu.
+func (m *memory) dedupe(u *URLMap) error {
+	if !u.Dedupe || !u.plain() {
+		return nil
+	}
+	if found, ok := m.findPlain(u); ok {
+		*u = *found
+		return ErrURLExists
+	}
+	return nil
+}
+
+func (m *memory) SaveNewURLFromID(ctx context.Context, u *URLMap, slugFor func(id int) string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.dedupe(u); err != nil {
+		return err
+	}
+	slug := slugFor(m.nextURLID + 1)
+	if _, ok := m.slugs[slugKey(slug)]; ok || slug == "" {
+		// Burn the id, as a database would
+		m.nextURLID++
+		return ErrSlugTaken
+	}
+	u.Slug = slug
+	return m.save(u)
+}
+
+// save stores a new url, setting u.ID. Callers must hold m.mu.
+func (m *memory) save(u *URLMap) error {
+	key := slugKey(u.Slug)
+	if _, ok := m.slugs[key]; ok {
+		return ErrSlugTaken
+	}
+
+	m.nextURLID++
+	u.ID = m.nextURLID
+	m.slugs[key] = m.nextURLID
+	stored := URLMap{
+		ID:           m.nextURLID,
+		Slug:         u.Slug,
+		URL:          u.URL,
+		MaxClicks:    u.MaxClicks,
+		PasswordHash: u.PasswordHash,
+		APIKeyID:     u.APIKeyID,
+		UserID:       u.UserID,
+		WorkspaceID:  u.WorkspaceID,
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+		Tags:         append([]string(nil), u.Tags...),
+	}
+	if u.ExpiresAt != nil {
+		t := u.ExpiresAt.UTC().Truncate(time.Second)
+		stored.ExpiresAt = &t
+	}
+	m.urls[m.nextURLID] = stored
+	u.CreatedAt = stored.CreatedAt
+	return nil
+}
+
+func (m *memory) UpdateURL(ctx context.Context, slug string, url string, scope Scope) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.live(slug)
+	if !ok {
+		return ErrNotFound
+	}
+
+	u := m.urls[id]
+	if !scope.Allows(&u) {
+		return ErrNotFound
+	}
+	u.URL = url
+	m.urls[id] = u
+	return nil
+}
+
+func (m *memory) DeleteURL(ctx context.Context, slug string, mode DeleteMode, scope Scope) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := slugKey(slug)
+	if mode == PurgeVisits {
+		id, ok := m.slugs[key]
+		if !ok {
+			return ErrNotFound
+		}
+		if u := m.urls[id]; !scope.Allows(&u) {
+			return ErrNotFound
+		}
+		delete(m.slugs, key)
+		delete(m.urls, id)
+		delete(m.deleted, id)
+		delete(m.visits, id)
+		return nil
+	}
+
+	id, ok := m.live(slug)
+	if !ok {
+		return ErrNotFound
+	}
+	if u := m.urls[id]; !scope.Allows(&u) {
+		return ErrNotFound
+	}
+	m.deleted[id] = true
+	return nil
+}
+
+func (m *memory) GetSlugs(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	slugs := make([]string, 0, len(m.urls))
+	for _, id := range m.urlIDs() {
+		slugs = append(slugs, m.urls[id].Slug)
+	}
+	return slugs, nil
+}
+
+func (m *memory) FoldSlugs(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	folded := make(map[string]int, len(m.slugs))
+	for key, id := range m.slugs {
+		k := slugKey(FoldSlug(key))
+		if _, ok := folded[k]; ok {
+			return 0, ErrSlugTaken
+		}
+		folded[k] = id
+	}
+
+	n := 0
+	for _, id := range m.urlIDs() {
+		u := m.urls[id]
+		if f := FoldSlug(u.Slug); f != u.Slug {
+			u.Slug = f
+			m.urls[id] = u
+			n++
+		}
+	}
+	m.slugs = folded
+	return n, nil
+}
+
+func (m *memory) TrackHits(ctx context.Context, hits []Hit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Like a foreign key, refuse the whole batch
+	for _, h := range hits {
+		if _, ok := m.urls[h.URLID]; !ok {
+			return errors.New("datastore: no url with that id")
+		}
+	}
+
+	for _, h := range hits {
+		m.nextVisitID++
+		m.visits[h.URLID] = append(m.visits[h.URLID], Visit{
+			ID:      m.nextVisitID,
+			Device:  h.Device,
+			OS:      h.OS,
+			Browser: h.Browser,
+			IP:      h.IP,
+			Time:    h.Time.UTC().Truncate(time.Second),
+		})
+	}
+	return nil
+}
+
+func (m *memory) CountVisits(ctx context.Context, urlID int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.visits[urlID]), nil
+}
+
+func (m *memory) ListURLs(ctx context.Context, scope Scope, opts ListOptions) ([]VisitCount, *Cursor, error) {
+	if err := opts.check(); err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	vc := make([]VisitCount, 0, len(m.urls))
+	for _, id := range m.urlIDs() {
+		u := m.urls[id]
+		if m.deleted[id] || !scope.Allows(&u) || !opts.matches(&u) {
+			continue
+		}
+		createdAt := u.CreatedAt
+		vc = append(vc, VisitCount{
+			ID:          u.ID,
+			Slug:        u.Slug,
+			URL:         u.URL,
+			Count:       len(m.visits[u.ID]),
+			ExpiresAt:   u.ExpiresAt,
+			MaxClicks:   u.MaxClicks,
+			Protected:   u.PasswordHash != "",
+			WorkspaceID: u.WorkspaceID,
+			CreatedAt:   &createdAt,
+			Tags:        append([]string(nil), u.Tags...),
+		})
+	}
+
+	// less reports whether a comes before b in ascending order
+	var less func(a, b VisitCount) bool
+	switch opts.sort() {
+	case SortCreated:
+		less = func(a, b VisitCount) bool { return a.ID < b.ID }
+	case SortSlug:
+		less = func(a, b VisitCount) bool { return a.Slug < b.Slug }
+	case SortClicks:
+		less = func(a, b VisitCount) bool { return a.Count < b.Count || a.Count == b.Count && a.ID < b.ID }
+	}
+	before := less
+	if opts.Desc {
+		before = func(a, b VisitCount) bool { return less(b, a) }
+	}
+	sort.SliceStable(vc, func(i, j int) bool { return before(vc[i], vc[j]) })
+
+	if c := opts.Cursor; c != nil {
+		last := VisitCount{ID: c.ID, Slug: c.Slug, Count: c.Clicks}
+		n := sort.Search(len(vc), func(i int) bool { return before(last, vc[i]) })
+		vc = vc[n:]
+	}
+	var next *Cursor
+	if opts.Limit > 0 && len(vc) > opts.Limit {
+		vc = vc[:opts.Limit]
+		next = cursorAfter(opts, vc[len(vc)-1])
+	}
+	return vc, next, nil
+}
+
+// matches reports whether u passes the filters in opts
+func (opts ListOptions) matches(u *URLMap) bool {
+	if !strings.HasPrefix(u.Slug, opts.SlugPrefix) {
+		return false
+	}
+	if opts.Host != "" {
+		found := false
+		url := strings.ToLower(u.URL)
+		for _, p := range hostPrefixes(opts.Host) {
+			found = found || strings.HasPrefix(url, p)
+		}
+		for _, h := range hostURLs(opts.Host) {
+			found = found || url == h
+		}
+		if !found {
+			return false
+		}
+	}
+	if opts.Tag != "" {
+		found := false
+		for _, t := range u.Tags {
+			found = found || t == opts.Tag
+		}
+		if !found {
+			return false
+		}
+	}
+	return (opts.APIKeyID == 0 || u.APIKeyID == opts.APIKeyID) &&
+		(opts.UserID == 0 || u.UserID == opts.UserID) &&
+		(opts.WorkspaceID == 0 || u.WorkspaceID == opts.WorkspaceID)
+}
+
+func (m *memory) GetVisits(ctx context.Context, slug string, scope Scope) (*URLMap, []Visit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.live(slug)
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	url := m.urls[id]
+	if !scope.Allows(&url) {
+		return nil, nil, ErrNotFound
+	}
+	if url.MaxClicks > 0 {
+		url.Clicks = len(m.visits[id])
+	}
+
+	// Most recent first
+	vs := m.visits[url.ID]
+	visits := make([]Visit, 0, len(vs))
+	for j := len(vs) - 1; j >= 0; j-- {
+		visits = append(visits, vs[j])
+	}
+
+	return &url, visits, nil
+}
+
+func (m *memory) SaveAPIKey(ctx context.Context, k *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.apiKeys {
+		if existing.Hash == k.Hash {
+			return errors.New("datastore: duplicate api key hash")
+		}
+	}
+
+	k.ID = len(m.apiKeys) + 1
+	k.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	k.RevokedAt = nil
+	m.apiKeys = append(m.apiKeys, *k)
+	return nil
+}
+
+func (m *memory) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, k := range m.apiKeys {
+		if k.Hash == hash {
+			return &k, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memory) GetAPIKeys(ctx context.Context) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]APIKey, len(m.apiKeys))
+	copy(keys, m.apiKeys)
+	return keys, nil
+}
+
+func (m *memory) RevokeAPIKey(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.apiKeys) || m.apiKeys[id-1].RevokedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	m.apiKeys[id-1].RevokedAt = &now
+	return nil
+}
+
+func (m *memory) SaveUser(ctx context.Context, u *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.users {
+		if existing.Username == u.Username {
+			return ErrUsernameTaken
+		}
+	}
+
+	u.ID = len(m.users) + 1
+	u.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	m.users = append(m.users, *u)
+	return nil
+}
+
+func (m *memory) GetUser(ctx context.Context, id int) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if id < 1 || id > len(m.users) {
+		return nil, ErrNotFound
+	}
+	u := m.users[id-1]
+	return &u, nil
+}
+
+func (m *memory) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memory) SaveSession(ctx context.Context, s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[s.Hash]; ok {
+		return errors.New("datastore: duplicate session hash")
+	}
+
+	m.nextSessID++
+	s.ID = m.nextSessID
+	s.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	m.sessions[s.Hash] = *s
+	return nil
+}
+
+func (m *memory) GetSessionByHash(ctx context.Context, hash string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (m *memory) DeleteSession(ctx context.Context, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, hash)
+	return nil
+}
+
+func (m *memory) SaveWorkspace(ctx context.Context, w *Workspace, ownerID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.ID = len(m.workspaces) + 1
+	w.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	m.workspaces = append(m.workspaces, *w)
+	m.members[w.ID] = map[int]Role{ownerID: RoleOwner}
+	return nil
+}
+
+func (m *memory) GetWorkspaces(ctx context.Context, userID int) ([]Membership, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ms := make([]Membership, 0)
+	for _, w := range m.workspaces {
+		if role, ok := m.members[w.ID][userID]; ok {
+			ms = append(ms, Membership{Workspace: w, Role: role})
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].Name < ms[j].Name })
+	return ms, nil
+}
+
+func (m *memory) GetMembers(ctx context.Context, workspaceID int) ([]Member, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := make([]Member, 0, len(m.members[workspaceID]))
+	for userID, role := range m.members[workspaceID] {
+		members = append(members, Member{
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+			Username:    m.users[userID-1].Username,
+			Role:        role,
+		})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Username < members[j].Username })
+	return members, nil
+}
+
+func (m *memory) SetMember(ctx context.Context, workspaceID, userID int, role Role) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.members[workspaceID] == nil || userID < 1 || userID > len(m.users) {
+		return errors.New("datastore: no such workspace or user")
+	}
+	if role != RoleOwner && !m.otherOwner(workspaceID, userID) {
+		return ErrLastOwner
+	}
+	m.members[workspaceID][userID] = role
+	return nil
+}
+
+func (m *memory) RemoveMember(ctx context.Context, workspaceID, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.members[workspaceID][userID]; !ok {
+		return ErrNotFound
+	}
+	if !m.otherOwner(workspaceID, userID) {
+		return ErrLastOwner
+	}
+	delete(m.members[workspaceID], userID)
+	return nil
+}
+
+// otherOwner reports whether a workspace has an owner besides userID.
+// Callers must hold m.mu.
+func (m *memory) otherOwner(workspaceID, userID int) bool {
+	for id, role := range m.members[workspaceID] {
+		if id != userID && role == RoleOwner {
+			return true
+		}
+	}
+	return false
+}
+
+// live returns the id of the url with the given slug, unless it doesn't
+// exist or has been deleted. Callers must hold m.mu.
+func (m *memory) live(slug string) (int, bool) {
+	id, ok := m.slugs[slugKey(slug)]
+	if !ok || m.deleted[id] {
+		return 0, false
+	}
+	return id, true
+}
+
+// urlIDs returns the ids of all stored urls in ascending order. Callers must
+// hold m.mu.
+func (m *memory) urlIDs() []int {
+	ids := make([]int, 0, len(m.urls))
+	for id := range m.urls {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,175 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemorySlugTaken(t *testing.T) {
+	ctx := context.Background()
+	ds := NewMemory()
+
+	first := &URLMap{Slug: "abc", URL: "https://one.example/"}
+	if err := ds.SaveNewURL(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == 0 {
+		t.Error("SaveNewURL didn't set the id")
+	}
+	if err := ds.SaveNewURL(ctx, &URLMap{Slug: "abc", URL: "https://two.example/"}); err != ErrSlugTaken {
+		t.Errorf("saving a taken slug = %v, want ErrSlugTaken", err)
+	}
+	// Slugs are case sensitive
+	if err := ds.SaveNewURL(ctx, &URLMap{Slug: "ABC", URL: "https://two.example/"}); err != nil {
+		t.Errorf("saving a slug differing in case = %v", err)
+	}
+
+	u, err := ds.GetURLBySlug(ctx, "abc")
+	if err != nil || u.URL != "https://one.example/" {
+		t.Errorf("GetURLBySlug = %v, %v, want the first url", u, err)
+	}
+
+	// Deleted slugs stay reserved unless purged
+	if err := ds.DeleteURL(ctx, "abc", KeepVisits, AllURLs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.GetURLBySlug(ctx, "abc"); err != ErrNotFound {
+		t.Errorf("GetURLBySlug of a deleted url = %v, want ErrNotFound", err)
+	}
+	if err := ds.SaveNewURL(ctx, &URLMap{Slug: "abc", URL: "https://two.example/"}); err != ErrSlugTaken {
+		t.Errorf("saving a deleted url's slug = %v, want ErrSlugTaken", err)
+	}
+
+	if err := ds.DeleteURL(ctx, "ABC", PurgeVisits, AllURLs); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.SaveNewURL(ctx, &URLMap{Slug: "ABC", URL: "https://three.example/"}); err != nil {
+		t.Errorf("saving a purged url's slug = %v", err)
+	}
+}
+
+func TestMemoryVisits(t *testing.T) {
+	ctx := context.Background()
+	ds := NewMemory()
+
+	a := &URLMap{Slug: "a", URL: "https://a.example/"}
+	b := &URLMap{Slug: "b", URL: "https://b.example/"}
+	for _, u := range []*URLMap{a, b} {
+		if err := ds.SaveNewURL(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Date(2018, 3, 5, 4, 0, 0, 0, time.UTC)
+	var hits []Hit
+	for i := 0; i < 3; i++ {
+		hits = append(hits, Hit{URLID: a.ID, Device: "Other", OS: "Linux", Browser: fmt.Sprint("Browser ", i), IP: "127.0.0.1", Time: start.Add(time.Duration(i) * time.Minute)})
+	}
+	hits = append(hits, Hit{URLID: b.ID, Device: "iPhone", OS: "iOS", Browser: "Safari", IP: "127.0.0.2", Time: start})
+	if err := ds.TrackHits(ctx, hits); err != nil {
+		t.Fatal(err)
+	}
+
+	// A batch with a missing url is refused whole
+	bad := []Hit{{URLID: a.ID, Time: start}, {URLID: 999, Time: start}}
+	if err := ds.TrackHits(ctx, bad); err == nil {
+		t.Error("TrackHits with a missing url succeeded")
+	}
+
+	if n, err := ds.CountVisits(ctx, a.ID); err != nil || n != 3 {
+		t.Errorf("CountVisits(a) = %d, %v, want 3", n, err)
+	}
+
+	vc, next, err := ds.ListURLs(ctx, AllURLs, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != nil {
+		t.Errorf("ListURLs without a limit returned a cursor")
+	}
+	counts := make(map[string]int)
+	for _, v := range vc {
+		counts[v.Slug] = v.Count
+	}
+	if len(vc) != 2 || counts["a"] != 3 || counts["b"] != 1 {
+		t.Errorf("ListURLs counts = %v, want a: 3, b: 1", counts)
+	}
+
+	u, visits, err := ds.GetVisits(ctx, "a", AllURLs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != a.ID || len(visits) != 3 {
+		t.Fatalf("GetVisits = %v with %d visits, want a with 3", u, len(visits))
+	}
+	// Most recent first
+	for i, v := range visits {
+		if want := fmt.Sprint("Browser ", 2-i); v.Browser != want || v.IP != "127.0.0.1" {
+			t.Errorf("visit %d = %+v, want %v", i, v, want)
+		}
+	}
+
+	// Visits are only shown to those who can see the url
+	if _, _, err := ds.GetVisits(ctx, "a", Scope{UserID: 1}); err != ErrNotFound {
+		t.Errorf("GetVisits out of scope = %v, want ErrNotFound", err)
+	}
+	if _, err := ds.GetURL(ctx, "a", Scope{UserID: 1}); err != ErrNotFound {
+		t.Errorf("GetURL out of scope = %v, want ErrNotFound", err)
+	}
+	if u, err := ds.GetURL(ctx, "a", AllURLs); err != nil || u.ID != a.ID {
+		t.Errorf("GetURL = %v, %v, want a", u, err)
+	}
+	if _, _, err := ds.GetVisits(ctx, "nope", AllURLs); err != ErrNotFound {
+		t.Errorf("GetVisits of a missing slug = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryConcurrentSave(t *testing.T) {
+	ctx := context.Background()
+	ds := NewMemory()
+
+	const workers = 50
+	var wg sync.WaitGroup
+	ids := make([]int, workers)
+	errs := make([]error, workers)
+	winners := make([]error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u := &URLMap{Slug: fmt.Sprintf("s%d", i), URL: "https://example.com/"}
+			errs[i] = ds.SaveNewURL(ctx, u)
+			ids[i] = u.ID
+
+			// Everyone also races for the same slug
+			winners[i] = ds.SaveNewURL(ctx, &URLMap{Slug: "same", URL: "https://example.com/"})
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool)
+	won := 0
+	for i := 0; i < workers; i++ {
+		if errs[i] != nil {
+			t.Errorf("SaveNewURL(s%d) = %v", i, errs[i])
+		}
+		if seen[ids[i]] {
+			t.Errorf("id %d was given out twice", ids[i])
+		}
+		seen[ids[i]] = true
+
+		switch winners[i] {
+		case nil:
+			won++
+		case ErrSlugTaken:
+		default:
+			t.Errorf("SaveNewURL(same) = %v", winners[i])
+		}
+	}
+	if won != 1 {
+		t.Errorf("%d saves of the same slug succeeded, want 1", won)
+	}
+}
@@ -0,0 +1,87 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/dabfleming/shorty/internal/redis"
+)
+
+// redisCache is a Cache kept in Redis, so every instance sees the same
+// entries and invalidations
+type redisCache struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisCache returns a Cache storing urls as JSON under keys starting
+// with prefix. Errors talking to Redis are logged and treated as misses, so
+// lookups fall back to the datastore.
+//
+// Only what forwarding needs is stored, so password hashes and owners stay
+// out of Redis. Password protected urls are stored as such and read as
+// misses, so their hash comes from the datastore when it's needed.
+func NewRedisCache(client *redis.Client, prefix string) Cache {
+	return redisCache{client: client, prefix: prefix}
+}
+
+// redisURL is the part of a URLMap kept in Redis
+type redisURL struct {
+	ID        int        `json:"id"`
+	Slug      string     `json:"slug"`
+	URL       string     `json:"url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MaxClicks int        `json:"max_clicks,omitempty"`
+	Protected bool       `json:"protected,omitempty"`
+}
+
+func (c redisCache) Get(ctx context.Context, slug string) (*URLMap, bool) {
+	b, err := c.client.Get(ctx, c.prefix+slug)
+	if err == redis.ErrNil {
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error reading cached url: %v", err)
+		return nil, false
+	}
+
+	// Unknown slugs are cached as null
+	var ru *redisURL
+	if err := json.Unmarshal(b, &ru); err != nil {
+		log.Printf("Error decoding cached url: %v", err)
+		return nil, false
+	}
+	if ru == nil {
+		return nil, true
+	}
+	if ru.Protected {
+		return nil, false
+	}
+	return &URLMap{ID: ru.ID, Slug: ru.Slug, URL: ru.URL, ExpiresAt: ru.ExpiresAt, MaxClicks: ru.MaxClicks}, true
+}
+
+func (c redisCache) Set(ctx context.Context, slug string, u *URLMap, ttl time.Duration) {
+	var ru *redisURL
+	if u != nil {
+		ru = &redisURL{ID: u.ID, Slug: u.Slug, ExpiresAt: u.ExpiresAt, MaxClicks: u.MaxClicks, Protected: u.PasswordHash != ""}
+		if !ru.Protected {
+			ru.URL = u.URL
+		}
+	}
+	b, err := json.Marshal(ru)
+	if err != nil {
+		log.Printf("Error encoding url to cache: %v", err)
+		return
+	}
+	if err := c.client.Set(ctx, c.prefix+slug, b, ttl); err != nil {
+		log.Printf("Error caching url: %v", err)
+	}
+}
+
+func (c redisCache) Delete(ctx context.Context, slug string) {
+	if _, err := c.client.Del(ctx, c.prefix+slug); err != nil {
+		log.Printf("Error removing cached url: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package datastore
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dabfleming/shorty/internal/redis"
+)
+
+// newTestRedis starts a fake Redis and returns a client for it
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	f, err := redis.NewFake()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := redis.New(f.Addr(), "", 0, time.Second)
+	t.Cleanup(func() {
+		c.Close()
+		f.Close()
+	})
+	return c
+}
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	c := NewRedisCache(client, "test:")
+
+	if _, ok := c.Get(ctx, "abc"); ok {
+		t.Fatal("Get of an empty cache hit")
+	}
+
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	c.Set(ctx, "abc", &URLMap{ID: 7, Slug: "abc", URL: "https://example.com/", ExpiresAt: &expires, UserID: 5, WorkspaceID: 3, Tags: []string{"t"}}, time.Minute)
+	u, ok := c.Get(ctx, "abc")
+	if !ok || u == nil {
+		t.Fatalf("Get after Set = %v, %v", u, ok)
+	}
+	if u.ID != 7 || u.Slug != "abc" || u.URL != "https://example.com/" || u.ExpiresAt == nil || !u.ExpiresAt.Equal(expires) {
+		t.Errorf("Get after Set = %+v", u)
+	}
+	// Owners aren't shared
+	if u.UserID != 0 || u.WorkspaceID != 0 || u.Tags != nil {
+		t.Errorf("Get after Set = %+v, want no owners or tags", u)
+	}
+
+	c.Delete(ctx, "abc")
+	if _, ok := c.Get(ctx, "abc"); ok {
+		t.Error("Get after Delete hit")
+	}
+
+	// Unknown slugs are cached too
+	c.Set(ctx, "nope", nil, time.Minute)
+	if u, ok := c.Get(ctx, "nope"); !ok || u != nil {
+		t.Errorf("Get of a negative entry = %v, %v, want nil, true", u, ok)
+	}
+
+	// Password protected urls are misses, and neither their hash nor their
+	// destination is stored
+	c.Set(ctx, "locked", &URLMap{ID: 8, Slug: "locked", URL: "https://secret.example/", PasswordHash: "$argon2id$hash"}, time.Minute)
+	if u, ok := c.Get(ctx, "locked"); ok {
+		t.Errorf("Get of a protected url = %+v, want a miss", u)
+	}
+	b, err := client.Get(ctx, "test:locked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); strings.Contains(s, "argon2id") || strings.Contains(s, "secret.example") {
+		t.Errorf("protected url stored as %s", s)
+	}
+
+	c.Set(ctx, "brief", &URLMap{Slug: "brief"}, 20*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get(ctx, "brief"); ok {
+		t.Error("Get after the ttl hit")
+	}
+}
+
+func TestCachedRedisInvalidation(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	mem := NewMemory()
+
+	// Two instances sharing one Redis
+	a := Cached(mem, NewRedisCache(client, "test:"), time.Minute, time.Minute)
+	b := Cached(mem, NewRedisCache(client, "test:"), time.Minute, time.Minute)
+
+	if _, err := a.GetURLBySlug(ctx, "x"); err != ErrNotFound {
+		t.Fatalf("GetURLBySlug of a new slug = %v, want ErrNotFound", err)
+	}
+	if err := b.SaveNewURL(ctx, &URLMap{Slug: "x", URL: "https://one.example/"}); err != nil {
+		t.Fatal(err)
+	}
+	u, err := a.GetURLBySlug(ctx, "x")
+	if err != nil || u.URL != "https://one.example/" {
+		t.Fatalf("GetURLBySlug after saving through another instance = %v, %v", u, err)
+	}
+
+	if err := b.UpdateURL(ctx, "x", "https://two.example/", AllURLs); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := a.GetURLBySlug(ctx, "x"); err != nil || u.URL != "https://two.example/" {
+		t.Errorf("GetURLBySlug after an update elsewhere = %v, %v, want two.example", u, err)
+	}
+
+	if err := b.DeleteURL(ctx, "x", KeepVisits, AllURLs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetURLBySlug(ctx, "x"); err != ErrNotFound {
+		t.Errorf("GetURLBySlug after a delete elsewhere = %v, want ErrNotFound", err)
+	}
+
+	// Protected urls always come from the datastore, with their hash
+	if err := b.SaveNewURL(ctx, &URLMap{Slug: "locked", URL: "https://secret.example/", PasswordHash: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if u, err := a.GetURLBySlug(ctx, "locked"); err != nil || u.PasswordHash != "hash" {
+			t.Errorf("GetURLBySlug of a protected url = %v, %v, want its hash", u, err)
+		}
+	}
+}
+
+func TestCachedStalledRedis(t *testing.T) {
+	// A Redis server that accepts connections but never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer nc.Close()
+		}
+	}()
+	client := redis.New(ln.Addr().String(), "", 0, 50*time.Millisecond)
+	defer client.Close()
+
+	ctx := context.Background()
+	mem := NewMemory()
+	if err := mem.SaveNewURL(ctx, &URLMap{Slug: "abc", URL: "https://example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lookups fall back to the datastore in time, whichever side of the
+	// cache the deadlines are
+	const query = 500 * time.Millisecond
+	tests := []struct {
+		name string
+		ds   Datastore
+	}{
+		{"deadlines inside", Cached(WithDeadlines(mem, query), NewRedisCache(client, "test:"), time.Minute, time.Minute)},
+		{"deadlines outside", WithDeadlines(Cached(mem, NewRedisCache(client, "test:"), time.Minute, time.Minute), query)},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		u, err := tt.ds.GetURLBySlug(ctx, "abc")
+		if err != nil || u.URL != "https://example.com/" {
+			t.Errorf("%v: GetURLBySlug = %v, %v, want the url from the datastore", tt.name, u, err)
+		}
+		if d := time.Since(start); d >= query {
+			t.Errorf("%v: GetURLBySlug took %v", tt.name, d)
+		}
+		if _, err := tt.ds.GetURLBySlug(ctx, "nope"); err != ErrNotFound {
+			t.Errorf("%v: GetURLBySlug of an unknown slug = %v, want ErrNotFound", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// User models someone who signs in to the web UI, or the account table
+type User struct {
+	ID       int
+	Username string
+	// PasswordHash is the hash of the user's password. See the passwords
+	// package.
+	PasswordHash string
+	CreatedAt    time.Time
+}
+
+// Scope returns the urls the user may act on with the given role: their own
+// urls, and those in the workspaces where they have that role or better
+func (u *User) Scope(ms []Membership, need Role) Scope {
+	sc := Scope{UserID: u.ID}
+	for _, m := range ms {
+		if m.Role.Includes(need) {
+			sc.WorkspaceIDs = append(sc.WorkspaceIDs, m.ID)
+		}
+	}
+	return sc
+}
+
+// Session models a signed in browser, or the session table. Only a hash of
+// the session token is stored; see passwords.HashToken.
+type Session struct {
+	ID        int
+	Hash      string
+	UserID    int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+func (ds datastore) SaveUser(ctx context.Context, u *User) error {
+	const query = `INSERT INTO account (username, password_hash) VALUES (?, ?)`
+	id, err := ds.dialect.insert(ctx, ds.db, query, u.Username, u.PasswordHash)
+	if ds.dialect.isDuplicateKey(err) {
+		return ErrUsernameTaken
+	}
+	if err != nil {
+		return err
+	}
+	u.ID = id
+	return nil
+}
+
+func (ds datastore) GetUser(ctx context.Context, id int) (*User, error) {
+	const query = `SELECT id, username, password_hash, created_at FROM account WHERE id = ?`
+	return scanUser(ds.db.QueryRowContext(ctx, ds.dialect.rebind(query), id))
+}
+
+func (ds datastore) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	const query = `SELECT id, username, password_hash, created_at FROM account WHERE username = ?`
+	return scanUser(ds.db.QueryRowContext(ctx, ds.dialect.rebind(query), username))
+}
+
+func (ds datastore) SaveSession(ctx context.Context, s *Session) error {
+	const query = `INSERT INTO session (token_hash, account_id, expires_at) VALUES (?, ?, ?)`
+	id, err := ds.dialect.insert(ctx, ds.db, query, s.Hash, s.UserID, s.ExpiresAt.UTC())
+	if err != nil {
+		return err
+	}
+	s.ID = id
+	return nil
+}
+
+func (ds datastore) GetSessionByHash(ctx context.Context, hash string) (*Session, error) {
+	var s Session
+	const query = `SELECT id, token_hash, account_id, created_at, expires_at FROM session WHERE token_hash = ?`
+	row := ds.db.QueryRowContext(ctx, ds.dialect.rebind(query), hash)
+	err := row.Scan(&s.ID, &s.Hash, &s.UserID, &s.CreatedAt, &s.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (ds datastore) DeleteSession(ctx context.Context, hash string) error {
+	const query = `DELETE FROM session WHERE token_hash = ?`
+	_, err := ds.db.ExecContext(ctx, ds.dialect.rebind(query), hash)
+	return err
+}
+
+func scanUser(row scanner) (*User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
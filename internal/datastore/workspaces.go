@@ -0,0 +1,197 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Role is what a member may do in a workspace. Each role can do everything
+// the roles before it can.
+type Role string
+
+// Roles, from least to most capable
+const (
+	// RoleViewer can see the workspace's urls and their visits
+	RoleViewer Role = "viewer"
+	// RoleEditor can also create, edit and delete urls
+	RoleEditor Role = "editor"
+	// RoleOwner can also manage the workspace's members
+	RoleOwner Role = "owner"
+)
+
+var roleRanks = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// Valid reports whether r is one of the known roles
+func (r Role) Valid() bool {
+	return roleRanks[r] != 0
+}
+
+// Includes reports whether r can do everything need can
+func (r Role) Includes(need Role) bool {
+	return r.Valid() && roleRanks[r] >= roleRanks[need]
+}
+
+// Workspace models a group of users sharing urls, or the workspace table
+type Workspace struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time
+}
+
+// Membership is a workspace along with a user's role in it
+type Membership struct {
+	Workspace
+	Role Role
+}
+
+// Member is a user belonging to a workspace, or the workspace_member table
+type Member struct {
+	WorkspaceID int
+	UserID      int
+	Username    string
+	Role        Role
+}
+
+func (ds datastore) SaveWorkspace(ctx context.Context, w *Workspace, ownerID int) error {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id, err := ds.dialect.insert(ctx, tx, `INSERT INTO workspace (name) VALUES (?)`, w.Name)
+	if err != nil {
+		return err
+	}
+
+	const query = `INSERT INTO workspace_member (workspace_id, account_id, role) VALUES (?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, ds.dialect.rebind(query), id, ownerID, RoleOwner); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	w.ID = id
+	return nil
+}
+
+func (ds datastore) GetWorkspaces(ctx context.Context, userID int) ([]Membership, error) {
+	const query = `SELECT w.id, w.name, w.created_at, m.role FROM workspace w
+		JOIN workspace_member m ON m.workspace_id = w.id
+		WHERE m.account_id = ? ORDER BY w.name, w.id`
+	rows, err := ds.db.QueryContext(ctx, ds.dialect.rebind(query), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := make([]Membership, 0)
+	for rows.Next() {
+		var m Membership
+		if err := rows.Scan(&m.ID, &m.Name, &m.CreatedAt, &m.Role); err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, rows.Err()
+}
+
+func (ds datastore) GetMembers(ctx context.Context, workspaceID int) ([]Member, error) {
+	const query = `SELECT m.workspace_id, m.account_id, a.username, m.role FROM workspace_member m
+		JOIN account a ON a.id = m.account_id
+		WHERE m.workspace_id = ? ORDER BY a.username`
+	rows, err := ds.db.QueryContext(ctx, ds.dialect.rebind(query), workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]Member, 0)
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Username, &m.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (ds datastore) SetMember(ctx context.Context, workspaceID, userID int, role Role) error {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ds.lockWorkspace(ctx, tx, workspaceID); err != nil {
+		return err
+	}
+
+	// Replace any existing membership, which works the same everywhere
+	// unlike upserts
+	const del = `DELETE FROM workspace_member WHERE workspace_id = ? AND account_id = ?`
+	if _, err := tx.ExecContext(ctx, ds.dialect.rebind(del), workspaceID, userID); err != nil {
+		return err
+	}
+	const ins = `INSERT INTO workspace_member (workspace_id, account_id, role) VALUES (?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, ds.dialect.rebind(ins), workspaceID, userID, role); err != nil {
+		return err
+	}
+	if err := ds.checkOwner(ctx, tx, workspaceID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ds datastore) RemoveMember(ctx context.Context, workspaceID, userID int) error {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ds.lockWorkspace(ctx, tx, workspaceID); err != nil {
+		return err
+	}
+
+	const query = `DELETE FROM workspace_member WHERE workspace_id = ? AND account_id = ?`
+	res, err := tx.ExecContext(ctx, ds.dialect.rebind(query), workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	if err := ds.checkOwner(ctx, tx, workspaceID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockWorkspace takes a write lock on the workspace's row, so changes to its
+// members are made one at a time. Otherwise two owners demoting each other
+// could each see the other still an owner, and both succeed.
+func (ds datastore) lockWorkspace(ctx context.Context, tx *sql.Tx, workspaceID int) error {
+	const query = `UPDATE workspace SET name = name WHERE id = ?`
+	_, err := tx.ExecContext(ctx, ds.dialect.rebind(query), workspaceID)
+	return err
+}
+
+// checkOwner returns ErrLastOwner if the workspace has no owner left
+func (ds datastore) checkOwner(ctx context.Context, tx *sql.Tx, workspaceID int) error {
+	const query = `SELECT COUNT(*) FROM workspace_member WHERE workspace_id = ? AND role = ?`
+	var owners int
+	if err := tx.QueryRowContext(ctx, ds.dialect.rebind(query), workspaceID, RoleOwner).Scan(&owners); err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
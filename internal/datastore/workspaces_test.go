@@ -0,0 +1,100 @@
+package datastore
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// testLastOwner checks members can't be changed or removed so a workspace
+// is left without an owner, even by owners demoting each other at once
+func testLastOwner(t *testing.T, ds Datastore) {
+	ctx := context.Background()
+	var users []*User
+	for _, name := range []string{"alice", "bob", "carol"} {
+		u := &User{Username: name}
+		if err := ds.SaveUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+	alice, bob, carol := users[0].ID, users[1].ID, users[2].ID
+	w := &Workspace{Name: "team"}
+	if err := ds.SaveWorkspace(ctx, w, alice); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name   string
+		change func() error
+		want   error
+	}{
+		{"demote the only owner", func() error { return ds.SetMember(ctx, w.ID, alice, RoleEditor) }, ErrLastOwner},
+		{"remove the only owner", func() error { return ds.RemoveMember(ctx, w.ID, alice) }, ErrLastOwner},
+		{"keep the only owner an owner", func() error { return ds.SetMember(ctx, w.ID, alice, RoleOwner) }, nil},
+		{"add a viewer", func() error { return ds.SetMember(ctx, w.ID, carol, RoleViewer) }, nil},
+		{"remove the viewer", func() error { return ds.RemoveMember(ctx, w.ID, carol) }, nil},
+		{"remove a non-member", func() error { return ds.RemoveMember(ctx, w.ID, carol) }, ErrNotFound},
+		{"add a second owner", func() error { return ds.SetMember(ctx, w.ID, bob, RoleOwner) }, nil},
+		{"demote the first owner", func() error { return ds.SetMember(ctx, w.ID, alice, RoleEditor) }, nil},
+		{"demote the second owner", func() error { return ds.SetMember(ctx, w.ID, bob, RoleViewer) }, ErrLastOwner},
+		{"remove the second owner", func() error { return ds.RemoveMember(ctx, w.ID, bob) }, ErrLastOwner},
+	}
+	for _, st := range steps {
+		if err := st.change(); err != st.want {
+			t.Errorf("%v = %v, want %v", st.name, err, st.want)
+		}
+	}
+	owners := func() int {
+		members, err := ds.GetMembers(ctx, w.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, m := range members {
+			if m.Role == RoleOwner {
+				n++
+			}
+		}
+		return n
+	}
+	if n := owners(); n != 1 {
+		t.Fatalf("%d owners after refused changes, want 1", n)
+	}
+
+	// Two owners demoting each other at once: one must be refused
+	for i := 0; i < 20; i++ {
+		if err := ds.SetMember(ctx, w.ID, alice, RoleOwner); err != nil {
+			t.Fatal(err)
+		}
+		if err := ds.SetMember(ctx, w.ID, bob, RoleOwner); err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for j, id := range []int{alice, bob} {
+			wg.Add(1)
+			go func(j, id int) {
+				defer wg.Done()
+				if j == 0 {
+					errs[j] = ds.SetMember(ctx, w.ID, id, RoleEditor)
+				} else {
+					errs[j] = ds.RemoveMember(ctx, w.ID, id)
+				}
+			}(j, id)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil && err != ErrLastOwner {
+				t.Fatal(err)
+			}
+		}
+		if n := owners(); n != 1 {
+			t.Fatalf("%d owners after owners demoted each other, want 1 (errors %v)", n, errs)
+		}
+	}
+}
+
+func TestMemoryLastOwner(t *testing.T) {
+	testLastOwner(t, NewMemory())
+}
@@ -0,0 +1,281 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed sql
+var files embed.FS
+
+// Migration is a single numbered schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied
+type Status struct {
+	Migration
+	Applied bool
+}
+
+// Migrator applies the embedded migrations for one SQL dialect, tracking
+// applied versions in the schema_migrations table
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New returns a Migrator for db. dialect is one of mysql, postgres or sqlite.
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	ms, err := load(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: ms,
+	}
+	return m, nil
+}
+
+// Up applies all pending migrations in order, returning the versions applied
+func (m *Migrator) Up(ctx context.Context) ([]int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for _, mig := range m.migrations {
+		if applied[mig.Version] {
+			continue
+		}
+		err := m.run(ctx, mig.Up, `INSERT INTO schema_migrations (version) VALUES (?)`, mig.Version)
+		if err != nil {
+			return done, fmt.Errorf("migrations: applying %04d_%s: %v", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig.Version)
+	}
+	return done, nil
+}
+
+// Down rolls back the n most recently applied migrations, returning the
+// versions rolled back
+func (m *Migrator) Down(ctx context.Context, n int) ([]int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < n; i-- {
+		mig := m.migrations[i]
+		if !applied[mig.Version] {
+			continue
+		}
+		err := m.run(ctx, mig.Down, `DELETE FROM schema_migrations WHERE version = ?`, mig.Version)
+		if err != nil {
+			return done, fmt.Errorf("migrations: rolling back %04d_%s: %v", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig.Version)
+	}
+	return done, nil
+}
+
+// Status lists every known migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		ss = append(ss, Status{Migration: mig, Applied: applied[mig.Version]})
+	}
+	return ss, nil
+}
+
+// applied creates the tracking table if needed and returns the set of
+// applied versions
+func (m *Migrator) applied(ctx context.Context) (map[int]bool, error) {
+	const create = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer NOT NULL PRIMARY KEY,
+		applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	if _, err := m.db.ExecContext(ctx, create); err != nil {
+		return nil, fmt.Errorf("migrations: creating schema_migrations: %v", err)
+	}
+
+	rows, err := m.db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// run executes the statements in script followed by the bookkeeping query
+// in a single transaction. MySQL commits DDL implicitly, so there a failed
+// migration may be left partially applied.
+func (m *Migrator) run(ctx context.Context, script, bookkeeping string, version int) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range statements(script) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	if m.dialect == "postgres" {
+		bookkeeping = strings.Replace(bookkeeping, "?", "$1", 1)
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// statements splits a migration script into individual statements. Not all
+// drivers accept several statements in one Exec, so we run them one by one.
+// Statements end with a semicolon outside quotes and comments; comments are
+// dropped. Quotes are escaped by doubling them, as backslash escapes aren't
+// understood, and statements with semicolons inside, like trigger bodies,
+// can't be split.
+func statements(script string) []string {
+	var stmts []string
+	var b strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(b.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		b.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// Strings and quoted identifiers run to the next matching quote.
+			// A doubled quote just starts the next run.
+			end := strings.IndexByte(script[i+1:], c)
+			if end < 0 {
+				b.WriteString(script[i:])
+				i = len(script)
+				continue
+			}
+			b.WriteString(script[i : i+end+2])
+			i += end + 1
+		case strings.HasPrefix(script[i:], "--"):
+			// Keep the newline ending the comment
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+				continue
+			}
+			i += end - 1
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+				continue
+			}
+			b.WriteByte(' ')
+			i += end + 3
+		case c == ';':
+			b.WriteByte(c)
+			flush()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	flush()
+	return stmts
+}
+
+// load reads the embedded migrations for dialect, named like
+// 0001_create_url_visit.up.sql and 0001_create_url_visit.down.sql
+func load(dialect string) ([]Migration, error) {
+	dir := path.Join("sql", dialect)
+	entries, err := files.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: no migrations for dialect %q", dialect)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("migrations: bad file name %q", name)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("migrations: bad version in %q: %v", name, err)
+		}
+
+		b, err := files.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = mig
+		}
+		if direction == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migrations: %04d_%s needs both up and down scripts", mig.Version, mig.Name)
+		}
+		ms = append(ms, *mig)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
@@ -0,0 +1,99 @@
+//go:build sqlite
+// +build sqlite
+
+package migrations
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dabfleming/shorty/internal/platform/sqlite"
+)
+
+func TestSQLiteRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.Connect(filepath.Join(t.TempDir(), "shorty.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []int
+	for _, mig := range m.migrations {
+		all = append(all, mig.Version)
+	}
+
+	// recorded returns the versions in schema_migrations
+	recorded := func() []int {
+		rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations ORDER BY version`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var vs []int
+		for rows.Next() {
+			var v int
+			if err := rows.Scan(&v); err != nil {
+				t.Fatal(err)
+			}
+			vs = append(vs, v)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return vs
+	}
+	check := func(step string, want []int) {
+		t.Helper()
+		if got := recorded(); !reflect.DeepEqual(got, want) {
+			t.Errorf("after %v schema_migrations has %v, want %v", step, got, want)
+		}
+		ss, err := m.Status(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, s := range ss {
+			if applied := i < len(want); s.Applied != applied {
+				t.Errorf("after %v %04d_%s applied = %v", step, s.Version, s.Name, s.Applied)
+			}
+		}
+	}
+
+	done, err := m.Up(ctx)
+	if err != nil || !reflect.DeepEqual(done, all) {
+		t.Fatalf("Up = %v, %v, want %v", done, err, all)
+	}
+	check("up", all)
+	if done, err := m.Up(ctx); err != nil || len(done) != 0 {
+		t.Errorf("second Up = %v, %v, want nothing to do", done, err)
+	}
+
+	// Roll back the last two, then everything, and go up again
+	n := len(all)
+	if done, err := m.Down(ctx, 2); err != nil || !reflect.DeepEqual(done, []int{all[n-1], all[n-2]}) {
+		t.Fatalf("Down(2) = %v, %v", done, err)
+	}
+	check("down 2", all[:n-2])
+	if done, err := m.Down(ctx, n); err != nil || len(done) != n-2 {
+		t.Fatalf("Down(%d) = %v, %v", n, done, err)
+	}
+	check("down all", nil)
+	// sqlite_sequence belongs to SQLite, and can't be dropped
+	var tables int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')`).Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Errorf("%d tables left after rolling everything back", tables)
+	}
+
+	if done, err := m.Up(ctx); err != nil || !reflect.DeepEqual(done, all) {
+		t.Fatalf("Up after Down = %v, %v, want %v", done, err, all)
+	}
+	check("up again", all)
+}
@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"empty", "", nil},
+		{"one", "CREATE TABLE a (id int);", []string{"CREATE TABLE a (id int);"}},
+		{"no final semicolon", "CREATE TABLE a (id int)", []string{"CREATE TABLE a (id int)"}},
+		{"several lines", "CREATE TABLE a (\n  id int\n);\nDROP TABLE b;\n", []string{"CREATE TABLE a (\n  id int\n);", "DROP TABLE b;"}},
+		{"one line", "DROP TABLE a; DROP TABLE b;", []string{"DROP TABLE a;", "DROP TABLE b;"}},
+		{"comment lines", "-- Drops a\nDROP TABLE a;\n-- and b\nDROP TABLE b;", []string{"DROP TABLE a;", "DROP TABLE b;"}},
+		{"trailing comment", "DROP TABLE a; -- gone\nDROP TABLE b;", []string{"DROP TABLE a;", "DROP TABLE b;"}},
+		{"comment after the semicolon's line", "UPDATE a SET b = 1 -- all of them;\nWHERE c;", []string{"UPDATE a SET b = 1 \nWHERE c;"}},
+		{"quote in a comment", "-- a can't be kept\nDROP TABLE a;", []string{"DROP TABLE a;"}},
+		{"block comment", "DROP /* the; old */ TABLE a;", []string{"DROP   TABLE a;"}},
+		{"semicolon in a string", "INSERT INTO a VALUES ('x;\ny');", []string{"INSERT INTO a VALUES ('x;\ny');"}},
+		{"doubled quotes", "INSERT INTO a VALUES ('it''s; here');", []string{"INSERT INTO a VALUES ('it''s; here');"}},
+		{"comment in a string", "INSERT INTO a VALUES ('-- not a comment');", []string{"INSERT INTO a VALUES ('-- not a comment');"}},
+		{"quoted identifiers", "ALTER TABLE `a;b` ADD \"c;d\" int;", []string{"ALTER TABLE `a;b` ADD \"c;d\" int;"}},
+		{"unterminated string", "INSERT INTO a VALUES ('x;", []string{"INSERT INTO a VALUES ('x;"}},
+		{"only comments", "-- nothing\n/* here */", nil},
+	}
+	for _, tt := range tests {
+		if got := statements(tt.script); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: statements(%q) = %q, want %q", tt.name, tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	var versions []int
+	for _, dialect := range []string{"mysql", "postgres", "sqlite"} {
+		ms, err := load(dialect)
+		if err != nil {
+			t.Fatalf("load(%q) = %v", dialect, err)
+		}
+		var vs []int
+		for i, m := range ms {
+			if m.Version != i+1 {
+				t.Errorf("%v migration %d is version %d", dialect, i, m.Version)
+			}
+			if len(statements(m.Up)) == 0 || len(statements(m.Down)) == 0 {
+				t.Errorf("%v %04d_%s has an empty script", dialect, m.Version, m.Name)
+			}
+			vs = append(vs, m.Version)
+		}
+		// Every dialect has the same migrations
+		if versions == nil {
+			versions = vs
+		} else if !reflect.DeepEqual(vs, versions) {
+			t.Errorf("%v has versions %v, want %v", dialect, vs, versions)
+		}
+	}
+
+	if _, err := load("oracle"); err == nil {
+		t.Error("load of an unknown dialect succeeded")
+	}
+}
@@ -0,0 +1,21 @@
+-- Tables may already exist in databases created from the old data/sql/shorty.sql
+CREATE TABLE IF NOT EXISTS `url` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `slug` varchar(50) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+  `url` varchar(4096) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `slug_idx` (`slug`) USING HASH
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE IF NOT EXISTS `visit` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `url_id` int(11) NOT NULL,
+  `device` varchar(100) NOT NULL,
+  `os` varchar(100) NOT NULL,
+  `browser` varchar(100) NOT NULL,
+  `ip` varchar(100) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `url_id` (`url_id`),
+  CONSTRAINT `visit_ibfk_1` FOREIGN KEY (`url_id`) REFERENCES `url` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
@@ -0,0 +1,2 @@
+-- Soft deleted urls keep their visits and their slug stays reserved
+ALTER TABLE `url` ADD COLUMN `deleted_at` datetime NULL DEFAULT NULL;
@@ -0,0 +1,3 @@
+-- Optional limits on how long, and for how many clicks, a url redirects
+ALTER TABLE `url` ADD COLUMN `expires_at` datetime NULL DEFAULT NULL;
+ALTER TABLE `url` ADD COLUMN `max_clicks` int(11) NULL DEFAULT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE `url` DROP FOREIGN KEY `url_ibfk_1`;
+ALTER TABLE `url` DROP COLUMN `api_key_id`;
+DROP TABLE IF EXISTS `api_key`;
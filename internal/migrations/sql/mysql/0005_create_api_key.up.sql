@@ -0,0 +1,15 @@
+CREATE TABLE `api_key` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `name` varchar(100) NOT NULL,
+  `key_hash` char(64) NOT NULL,
+  `admin` tinyint(1) NOT NULL DEFAULT 0,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `revoked_at` datetime NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `key_hash_idx` (`key_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+-- The key a url was created with owns it
+ALTER TABLE `url` ADD COLUMN `api_key_id` int(11) NULL DEFAULT NULL,
+  ADD KEY `api_key_id` (`api_key_id`),
+  ADD CONSTRAINT `url_ibfk_1` FOREIGN KEY (`api_key_id`) REFERENCES `api_key` (`id`) ON DELETE SET NULL;
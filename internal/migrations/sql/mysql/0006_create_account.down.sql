@@ -0,0 +1,4 @@
+ALTER TABLE `url` DROP FOREIGN KEY `url_ibfk_2`;
+ALTER TABLE `url` DROP COLUMN `account_id`;
+DROP TABLE IF EXISTS `session`;
+DROP TABLE IF EXISTS `account`;
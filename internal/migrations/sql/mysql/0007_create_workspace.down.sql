@@ -0,0 +1,4 @@
+ALTER TABLE `url` DROP FOREIGN KEY `url_ibfk_3`;
+ALTER TABLE `url` DROP COLUMN `workspace_id`;
+DROP TABLE IF EXISTS `workspace_member`;
+DROP TABLE IF EXISTS `workspace`;
@@ -0,0 +1,22 @@
+CREATE TABLE `workspace` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `name` varchar(100) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+CREATE TABLE `workspace_member` (
+  `workspace_id` int(11) NOT NULL,
+  `account_id` int(11) NOT NULL,
+  `role` varchar(10) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`workspace_id`, `account_id`),
+  KEY `account_id` (`account_id`),
+  CONSTRAINT `workspace_member_ibfk_1` FOREIGN KEY (`workspace_id`) REFERENCES `workspace` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `workspace_member_ibfk_2` FOREIGN KEY (`account_id`) REFERENCES `account` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+
+-- Urls in a workspace are shared by its members
+ALTER TABLE `url` ADD COLUMN `workspace_id` int(11) NULL DEFAULT NULL,
+  ADD KEY `workspace_id` (`workspace_id`),
+  ADD CONSTRAINT `url_ibfk_3` FOREIGN KEY (`workspace_id`) REFERENCES `workspace` (`id`) ON DELETE SET NULL;
@@ -0,0 +1 @@
+DROP INDEX `url_url` ON `url`;
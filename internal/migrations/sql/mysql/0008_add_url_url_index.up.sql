@@ -0,0 +1,3 @@
+-- Finds existing links to the same destination. Urls are too long to
+-- index whole, so only a prefix is.
+CREATE INDEX `url_url` ON `url` (`url`(255));
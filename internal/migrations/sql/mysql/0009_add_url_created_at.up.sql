@@ -0,0 +1,3 @@
+-- When each url was created, for listing them newest first. Existing urls
+-- get the time of the migration.
+ALTER TABLE `url` ADD COLUMN `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,8 @@
+-- Free form labels for grouping and filtering urls
+CREATE TABLE `url_tag` (
+  `url_id` int(11) NOT NULL,
+  `tag` varchar(32) NOT NULL,
+  PRIMARY KEY (`url_id`, `tag`),
+  KEY `tag` (`tag`),
+  CONSTRAINT `url_tag_ibfk_1` FOREIGN KEY (`url_id`) REFERENCES `url` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
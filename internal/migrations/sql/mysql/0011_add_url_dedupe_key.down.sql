@@ -0,0 +1,2 @@
+DROP INDEX `url_dedupe_key` ON `url`;
+ALTER TABLE `url` DROP COLUMN `dedupe_key`;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS visit;
+DROP TABLE IF EXISTS url;
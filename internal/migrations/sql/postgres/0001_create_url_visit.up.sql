@@ -0,0 +1,18 @@
+-- Tables may already exist in databases created from the old data/sql/shorty_postgres.sql
+CREATE TABLE IF NOT EXISTS url (
+  id serial PRIMARY KEY,
+  slug varchar(50) COLLATE "C" NOT NULL,
+  url varchar(4096) NOT NULL,
+  CONSTRAINT slug_idx UNIQUE (slug)
+);
+
+CREATE TABLE IF NOT EXISTS visit (
+  id serial PRIMARY KEY,
+  url_id integer NOT NULL REFERENCES url (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  device varchar(100) NOT NULL,
+  os varchar(100) NOT NULL,
+  browser varchar(100) NOT NULL,
+  ip varchar(100) NOT NULL,
+  created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS url_id ON visit (url_id);
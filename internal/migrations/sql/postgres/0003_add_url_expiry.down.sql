@@ -0,0 +1,2 @@
+ALTER TABLE url DROP COLUMN max_clicks;
+ALTER TABLE url DROP COLUMN expires_at;
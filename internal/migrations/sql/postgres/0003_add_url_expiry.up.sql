@@ -0,0 +1,3 @@
+-- Optional limits on how long, and for how many clicks, a url redirects
+ALTER TABLE url ADD COLUMN expires_at timestamp NULL DEFAULT NULL;
+ALTER TABLE url ADD COLUMN max_clicks integer NULL DEFAULT NULL;
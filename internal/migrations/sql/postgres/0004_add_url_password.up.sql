@@ -0,0 +1,2 @@
+-- Hash of the password needed to follow the url, if any
+ALTER TABLE url ADD COLUMN password_hash varchar(255) NULL DEFAULT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE url DROP COLUMN api_key_id;
+DROP TABLE IF EXISTS api_key;
@@ -0,0 +1,13 @@
+CREATE TABLE api_key (
+  id serial PRIMARY KEY,
+  name varchar(100) NOT NULL,
+  key_hash char(64) NOT NULL,
+  admin boolean NOT NULL DEFAULT false,
+  created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  revoked_at timestamp NULL DEFAULT NULL,
+  CONSTRAINT key_hash_idx UNIQUE (key_hash)
+);
+
+-- The key a url was created with owns it
+ALTER TABLE url ADD COLUMN api_key_id integer NULL DEFAULT NULL REFERENCES api_key (id) ON DELETE SET NULL;
+CREATE INDEX api_key_id ON url (api_key_id);
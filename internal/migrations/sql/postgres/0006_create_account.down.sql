@@ -0,0 +1,3 @@
+ALTER TABLE url DROP COLUMN account_id;
+DROP TABLE IF EXISTS session;
+DROP TABLE IF EXISTS account;
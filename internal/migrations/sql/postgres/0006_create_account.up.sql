@@ -0,0 +1,22 @@
+-- Users are stored as accounts, since user is reserved in PostgreSQL
+CREATE TABLE account (
+  id serial PRIMARY KEY,
+  username varchar(32) NOT NULL,
+  password_hash varchar(255) NOT NULL,
+  created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT username_idx UNIQUE (username)
+);
+
+CREATE TABLE session (
+  id serial PRIMARY KEY,
+  token_hash char(64) NOT NULL,
+  account_id integer NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+  created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at timestamp NOT NULL,
+  CONSTRAINT token_hash_idx UNIQUE (token_hash)
+);
+CREATE INDEX session_account_id ON session (account_id);
+
+-- The user a url was created by owns it
+ALTER TABLE url ADD COLUMN account_id integer NULL DEFAULT NULL REFERENCES account (id) ON DELETE SET NULL;
+CREATE INDEX account_id ON url (account_id);
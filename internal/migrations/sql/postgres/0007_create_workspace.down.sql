@@ -0,0 +1,3 @@
+ALTER TABLE url DROP COLUMN workspace_id;
+DROP TABLE IF EXISTS workspace_member;
+DROP TABLE IF EXISTS workspace;
@@ -0,0 +1,3 @@
+-- Finds existing links to the same destination. A hash index has no limit
+-- on the length of urls, unlike a btree.
+CREATE INDEX url_url ON url USING hash (url);
@@ -0,0 +1,7 @@
+-- Free form labels for grouping and filtering urls
+CREATE TABLE url_tag (
+  url_id integer NOT NULL REFERENCES url (id) ON DELETE CASCADE,
+  tag varchar(32) NOT NULL,
+  PRIMARY KEY (url_id, tag)
+);
+CREATE INDEX url_tag_tag ON url_tag (tag);
@@ -0,0 +1,19 @@
+-- Tables may already exist in databases created from the old data/sql/shorty_sqlite.sql
+CREATE TABLE IF NOT EXISTS `url` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `slug` varchar(50) NOT NULL COLLATE BINARY,
+  `url` varchar(4096) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `slug_idx` ON `url` (`slug`);
+
+CREATE TABLE IF NOT EXISTS `visit` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `url_id` int(11) NOT NULL,
+  `device` varchar(100) NOT NULL,
+  `os` varchar(100) NOT NULL,
+  `browser` varchar(100) NOT NULL,
+  `ip` varchar(100) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT `visit_ibfk_1` FOREIGN KEY (`url_id`) REFERENCES `url` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS `url_id` ON `visit` (`url_id`);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS `api_key_id`;
+ALTER TABLE `url` DROP COLUMN `api_key_id`;
+DROP TABLE IF EXISTS `api_key`;
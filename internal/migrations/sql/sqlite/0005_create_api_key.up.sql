@@ -0,0 +1,13 @@
+CREATE TABLE `api_key` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `name` varchar(100) NOT NULL,
+  `key_hash` char(64) NOT NULL,
+  `admin` boolean NOT NULL DEFAULT 0,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `revoked_at` datetime NULL DEFAULT NULL
+);
+CREATE UNIQUE INDEX `key_hash_idx` ON `api_key` (`key_hash`);
+
+-- The key a url was created with owns it
+ALTER TABLE `url` ADD COLUMN `api_key_id` INTEGER NULL DEFAULT NULL REFERENCES `api_key` (`id`) ON DELETE SET NULL;
+CREATE INDEX `api_key_id` ON `url` (`api_key_id`);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS `account_id`;
+ALTER TABLE `url` DROP COLUMN `account_id`;
+DROP TABLE IF EXISTS `session`;
+DROP TABLE IF EXISTS `account`;
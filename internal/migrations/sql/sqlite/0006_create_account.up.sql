@@ -0,0 +1,21 @@
+CREATE TABLE `account` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `username` varchar(32) NOT NULL,
+  `password_hash` varchar(255) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX `username_idx` ON `account` (`username`);
+
+CREATE TABLE `session` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `token_hash` char(64) NOT NULL,
+  `account_id` INTEGER NOT NULL REFERENCES `account` (`id`) ON DELETE CASCADE,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `expires_at` datetime NOT NULL
+);
+CREATE UNIQUE INDEX `token_hash_idx` ON `session` (`token_hash`);
+CREATE INDEX `session_account_id` ON `session` (`account_id`);
+
+-- The user a url was created by owns it
+ALTER TABLE `url` ADD COLUMN `account_id` INTEGER NULL DEFAULT NULL REFERENCES `account` (`id`) ON DELETE SET NULL;
+CREATE INDEX `account_id` ON `url` (`account_id`);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS `workspace_id`;
+ALTER TABLE `url` DROP COLUMN `workspace_id`;
+DROP TABLE IF EXISTS `workspace_member`;
+DROP TABLE IF EXISTS `workspace`;
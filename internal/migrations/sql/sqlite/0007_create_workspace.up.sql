@@ -0,0 +1,18 @@
+CREATE TABLE `workspace` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `name` varchar(100) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE `workspace_member` (
+  `workspace_id` INTEGER NOT NULL REFERENCES `workspace` (`id`) ON DELETE CASCADE,
+  `account_id` INTEGER NOT NULL REFERENCES `account` (`id`) ON DELETE CASCADE,
+  `role` varchar(10) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`workspace_id`, `account_id`)
+);
+CREATE INDEX `workspace_member_account_id` ON `workspace_member` (`account_id`);
+
+-- Urls in a workspace are shared by its members
+ALTER TABLE `url` ADD COLUMN `workspace_id` INTEGER NULL DEFAULT NULL REFERENCES `workspace` (`id`) ON DELETE SET NULL;
+CREATE INDEX `workspace_id` ON `url` (`workspace_id`);
@@ -0,0 +1,2 @@
+-- Finds existing links to the same destination
+CREATE INDEX `url_url` ON `url` (`url`);
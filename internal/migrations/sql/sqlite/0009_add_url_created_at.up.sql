@@ -0,0 +1,5 @@
+-- When each url was created, for listing them newest first. SQLite can't
+-- add a column defaulting to CURRENT_TIMESTAMP, so existing urls are given
+-- the time of the migration and new ones have it set when inserted.
+ALTER TABLE `url` ADD COLUMN `created_at` datetime NULL DEFAULT NULL;
+UPDATE `url` SET `created_at` = CURRENT_TIMESTAMP;
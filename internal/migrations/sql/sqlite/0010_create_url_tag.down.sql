@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS `url_tag_tag`;
+DROP TABLE IF EXISTS `url_tag`;
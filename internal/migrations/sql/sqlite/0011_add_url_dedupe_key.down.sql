@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS `url_dedupe_key`;
+ALTER TABLE `url` DROP COLUMN `dedupe_key`;
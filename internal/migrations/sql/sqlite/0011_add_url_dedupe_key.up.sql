@@ -0,0 +1,5 @@
+-- Identifies a plain url by its owner and destination when it was saved
+-- deduplicated, so concurrent saves can't both create one. Urls saved
+-- before, or not deduplicated, have none.
+ALTER TABLE `url` ADD COLUMN `dedupe_key` char(64) NULL DEFAULT NULL;
+CREATE UNIQUE INDEX `url_dedupe_key` ON `url` (`dedupe_key`);
@@ -0,0 +1,80 @@
+package passwords
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Hashes are stored as pbkdf2-sha256$<iterations>$<salt>$<key>, with salt
+// and key base64 encoded, so the cost can be raised without breaking
+// existing hashes.
+const (
+	scheme     = "pbkdf2-sha256"
+	iterations = 600000
+	saltLength = 16
+	keyLength  = 32
+)
+
+var encoding = base64.RawStdEncoding
+
+// ErrMalformed is returned when a stored hash can't be parsed
+var ErrMalformed = errors.New("passwords: malformed hash")
+
+// missing is checked in place of the hash of a user that doesn't exist. It
+// has the cost of a real hash, but no password matches it.
+var missing = fmt.Sprintf("%s$%d$%s$%s", scheme, iterations, encoding.EncodeToString(make([]byte, saltLength)), encoding.EncodeToString(make([]byte, keyLength)))
+
+// Hash returns a salted hash of password, suitable for storage
+func Hash(password string) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, keyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s$%d$%s$%s", scheme, iterations, encoding.EncodeToString(salt), encoding.EncodeToString(key)), nil
+}
+
+// Check reports whether password matches a hash returned by Hash
+func Check(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != scheme {
+		return false, ErrMalformed
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter < 1 {
+		return false, ErrMalformed
+	}
+	salt, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return false, ErrMalformed
+	}
+	want, err := encoding.DecodeString(parts[3])
+	if err != nil {
+		return false, ErrMalformed
+	}
+
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// CheckMissing does the work of Check for a user that doesn't exist, so how
+// long a login takes doesn't reveal which usernames are taken
+func CheckMissing(password string) {
+	Check(missing, password)
+}
@@ -0,0 +1,44 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	hash, err := Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == other {
+		t.Error("two hashes of one password are the same, so aren't salted")
+	}
+
+	tests := []struct {
+		hash, password string
+		ok             bool
+		err            error
+	}{
+		{hash, "correct horse", true, nil},
+		{hash, "Correct horse", false, nil},
+		{hash, "", false, nil},
+		// Doesn't match anything, but costs as much as a real hash
+		{missing, "", false, nil},
+		{missing, "correct horse", false, nil},
+		{"", "x", false, ErrMalformed},
+		{"md5$1$c2FsdA$a2V5", "x", false, ErrMalformed},
+		{strings.Replace(hash, "$600000$", "$0$", 1), "x", false, ErrMalformed},
+		{strings.Replace(hash, "$600000$", "$many$", 1), "x", false, ErrMalformed},
+		{hash + "$", "x", false, ErrMalformed},
+	}
+	for _, tt := range tests {
+		ok, err := Check(tt.hash, tt.password)
+		if ok != tt.ok || err != tt.err {
+			t.Errorf("Check(%q, %q) = %v, %v, want %v, %v", tt.hash, tt.password, ok, err, tt.ok, tt.err)
+		}
+	}
+}
@@ -3,15 +3,20 @@ package mysql
 import (
 	"database/sql"
 
-	// Load mysql driver
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
-// Connect connects to the database
-func Connect() (*sql.DB, error) {
-	// TODO Get this from environment
-	url := "username:password@tcp(localhost:3306)/shorty?charset=utf8&parseTime=true"
-	db, err := sql.Open("mysql", url)
+// Connect connects to the database described by dsn, e.g.
+// username:password@tcp(localhost:3306)/shorty?charset=utf8&parseTime=true
+func Connect(dsn string) (*sql.DB, error) {
+	// The datastore scans DATETIME columns into time.Time
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ParseTime = true
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,11 @@
+//go:build postgres
+// +build postgres
+
+package postgres
+
+import (
+	// Load postgres driver. PostgreSQL support is optional, like SQLite's, so
+	// the driver is only linked in with -tags postgres; without it Connect
+	// returns ErrNoDriver.
+	_ "github.com/lib/pq"
+)
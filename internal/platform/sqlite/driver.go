@@ -0,0 +1,9 @@
+//go:build sqlite
+// +build sqlite
+
+package sqlite
+
+import (
+	// Load sqlite driver. It requires cgo, so is only built with -tags sqlite.
+	_ "github.com/mattn/go-sqlite3"
+)
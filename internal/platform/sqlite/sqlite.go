@@ -0,0 +1,45 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// driverName is the database/sql driver registered by github.com/mattn/go-sqlite3
+const driverName = "sqlite3"
+
+// ErrNoDriver is returned by Connect when shorty was built without SQLite support
+var ErrNoDriver = errors.New("sqlite: driver not compiled in, rebuild with -tags sqlite")
+
+// Connect opens the SQLite database file at path, creating it if necessary
+func Connect(path string) (*sql.DB, error) {
+	if !registered() {
+		return nil, ErrNoDriver
+	}
+
+	// Foreign keys are off by default in SQLite, and we rely on them to
+	// cascade visit deletes. The busy timeout stops concurrent writers
+	// failing immediately with "database is locked".
+	url := fmt.Sprintf("file:%s?_foreign_keys=1&_busy_timeout=5000", path)
+	db, err := sql.Open(driverName, url)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// registered reports whether the SQLite driver has been linked in
+func registered() bool {
+	for _, d := range sql.Drivers() {
+		if d == driverName {
+			return true
+		}
+	}
+	return false
+}
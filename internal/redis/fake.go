@@ -0,0 +1,323 @@
+package redis
+
+import (
+	"bufio"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fake is an in-process server speaking the Redis protocol, holding data
+// in memory. It understands the commands Client sends and little else, and
+// is meant for development and tests rather than production.
+type Fake struct {
+	ln net.Listener
+
+	mu     sync.Mutex
+	values map[string]*fakeValue
+}
+
+type fakeValue struct {
+	str     []byte
+	zset    map[string]float64 // nil unless the value is a sorted set
+	expires time.Time          // zero if it doesn't expire
+}
+
+// NewFake starts a Fake listening on a free local port
+func NewFake() (*Fake, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	f := &Fake{ln: ln, values: make(map[string]*fakeValue)}
+	go f.serve()
+	return f, nil
+}
+
+// Addr is the address the Fake listens on
+func (f *Fake) Addr() string {
+	return f.ln.Addr().String()
+}
+
+// Close stops the Fake listening. Open connections are left to finish.
+func (f *Fake) Close() error {
+	return f.ln.Close()
+}
+
+func (f *Fake) serve() {
+	for {
+		nc, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(nc)
+	}
+}
+
+func (f *Fake) handle(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+
+	for {
+		req, err := readReply(r)
+		if err != nil {
+			return
+		}
+		a, ok := req.([]interface{})
+		if !ok || len(a) == 0 {
+			writeReply(w, Error("ERR commands must be arrays of bulk strings"))
+		} else {
+			args := make([]string, len(a))
+			for i, v := range a {
+				b, _ := v.([]byte)
+				args[i] = string(b)
+			}
+			writeReply(w, f.do(args))
+		}
+		// Only flush once a pipeline's commands are all answered
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+var (
+	errSyntax    = Error("ERR syntax error")
+	errNotInt    = Error("ERR value is not an integer or out of range")
+	errWrongType = Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+)
+
+// do runs one command
+func (f *Fake) do(args []string) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cmd, args := strings.ToUpper(args[0]), args[1:]
+	switch cmd {
+	case "PING":
+		return "PONG"
+	case "AUTH", "SELECT":
+		return "OK"
+	case "FLUSHALL", "FLUSHDB":
+		f.values = make(map[string]*fakeValue)
+		return "OK"
+
+	case "GET":
+		if len(args) != 1 {
+			return errSyntax
+		}
+		v := f.get(args[0])
+		if v == nil {
+			return nil
+		}
+		if v.zset != nil {
+			return errWrongType
+		}
+		return v.str
+
+	case "SET":
+		if len(args) < 2 {
+			return errSyntax
+		}
+		v := &fakeValue{str: []byte(args[1])}
+		nx := false
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX", "EX":
+				if i+1 == len(args) {
+					return errSyntax
+				}
+				n, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil || n <= 0 {
+					return errNotInt
+				}
+				unit := time.Millisecond
+				if strings.ToUpper(args[i]) == "EX" {
+					unit = time.Second
+				}
+				v.expires = time.Now().Add(time.Duration(n) * unit)
+				i++
+			default:
+				return errSyntax
+			}
+		}
+		if nx && f.get(args[0]) != nil {
+			return nil
+		}
+		f.values[args[0]] = v
+		return "OK"
+
+	case "DEL":
+		n := int64(0)
+		for _, k := range args {
+			if f.get(k) != nil {
+				delete(f.values, k)
+				n++
+			}
+		}
+		return n
+
+	case "EXISTS":
+		n := int64(0)
+		for _, k := range args {
+			if f.get(k) != nil {
+				n++
+			}
+		}
+		return n
+
+	case "INCR", "DECR", "INCRBY", "DECRBY":
+		by := int64(1)
+		if cmd == "INCRBY" || cmd == "DECRBY" {
+			if len(args) != 2 {
+				return errSyntax
+			}
+			var err error
+			if by, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return errNotInt
+			}
+		} else if len(args) != 1 {
+			return errSyntax
+		}
+		if cmd == "DECR" || cmd == "DECRBY" {
+			by = -by
+		}
+
+		v := f.get(args[0])
+		if v == nil {
+			v = &fakeValue{str: []byte("0")}
+			f.values[args[0]] = v
+		}
+		if v.zset != nil {
+			return errWrongType
+		}
+		n, err := strconv.ParseInt(string(v.str), 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		n += by
+		v.str = []byte(strconv.FormatInt(n, 10))
+		return n
+
+	case "ZADD":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return errSyntax
+		}
+		v := f.get(args[0])
+		if v == nil {
+			v = &fakeValue{zset: make(map[string]float64)}
+			f.values[args[0]] = v
+		}
+		if v.zset == nil {
+			return errWrongType
+		}
+		added := int64(0)
+		for i := 1; i < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil {
+				return Error("ERR value is not a valid float")
+			}
+			if _, ok := v.zset[args[i+1]]; !ok {
+				added++
+			}
+			v.zset[args[i+1]] = score
+		}
+		return added
+
+	case "ZREM":
+		if len(args) < 2 {
+			return errSyntax
+		}
+		v := f.get(args[0])
+		if v == nil {
+			return int64(0)
+		}
+		if v.zset == nil {
+			return errWrongType
+		}
+		removed := int64(0)
+		for _, m := range args[1:] {
+			if _, ok := v.zset[m]; ok {
+				delete(v.zset, m)
+				removed++
+			}
+		}
+		if len(v.zset) == 0 {
+			delete(f.values, args[0])
+		}
+		return removed
+
+	case "ZRANGEBYSCORE":
+		if len(args) != 3 {
+			return errSyntax
+		}
+		min, minOpen, ok1 := parseScore(args[1])
+		max, maxOpen, ok2 := parseScore(args[2])
+		if !ok1 || !ok2 {
+			return Error("ERR min or max is not a float")
+		}
+		v := f.get(args[0])
+		if v == nil {
+			return []interface{}{}
+		}
+		if v.zset == nil {
+			return errWrongType
+		}
+		var members []string
+		for m, s := range v.zset {
+			if (s > min || !minOpen && s == min) && (s < max || !maxOpen && s == max) {
+				members = append(members, m)
+			}
+		}
+		sort.Slice(members, func(i, j int) bool {
+			si, sj := v.zset[members[i]], v.zset[members[j]]
+			return si < sj || si == sj && members[i] < members[j]
+		})
+		reply := make([]interface{}, len(members))
+		for i, m := range members {
+			reply[i] = []byte(m)
+		}
+		return reply
+
+	default:
+		return Error("ERR unknown command '" + cmd + "'")
+	}
+}
+
+// get returns the value at key, forgetting it if it has expired. Callers
+// must hold f.mu.
+func (f *Fake) get(key string) *fakeValue {
+	v, ok := f.values[key]
+	if !ok {
+		return nil
+	}
+	if !v.expires.IsZero() && time.Now().After(v.expires) {
+		delete(f.values, key)
+		return nil
+	}
+	return v
+}
+
+// parseScore parses a ZRANGEBYSCORE bound like 1.5, (1.5 or -inf
+func parseScore(s string) (score float64, open bool, ok bool) {
+	if strings.HasPrefix(s, "(") {
+		open, s = true, s[1:]
+	}
+	switch strings.ToLower(s) {
+	case "-inf":
+		return math.Inf(-1), open, true
+	case "+inf", "inf":
+		return math.Inf(1), open, true
+	}
+	score, err := strconv.ParseFloat(s, 64)
+	return score, open, err == nil
+}
@@ -0,0 +1,277 @@
+// Package redis is a small client for servers speaking the Redis protocol,
+// with only the commands shorty needs, and an in-process Fake server to run
+// it against without Redis installed
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNil is returned when a key doesn't exist
+var ErrNil = errors.New("redis: nil")
+
+// Error is an error reply from the server
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// maxIdle is how many connections are kept open between commands
+const maxIdle = 16
+
+// Client sends commands to one server over a pool of connections. It is
+// safe for concurrent use.
+type Client struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	idle []*conn
+}
+
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+// New returns a Client for the server at addr, authenticating with password
+// if it isn't empty and using database db. Every command is given at most
+// timeout, on top of any deadline its context already has, so a stalled
+// server can't use up a caller's whole budget. No connection is made until
+// the first command.
+func New(addr, password string, db int, timeout time.Duration) *Client {
+	return &Client{addr: addr, password: password, db: db, timeout: timeout}
+}
+
+// Close closes the idle connections
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cn := range c.idle {
+		cn.nc.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// Do sends one command, returning its reply. Error replies are returned as
+// an Error.
+func (c *Client) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	replies, err := c.Pipeline(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := replies[0].(Error); ok {
+		return nil, e
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends several commands at once, then reads their replies. Error
+// replies are left in the returned slice, so one failing doesn't hide the
+// others' results.
+func (c *Client) Pipeline(ctx context.Context, cmds ...[]interface{}) ([]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := cn.pipeline(ctx, cmds)
+	if err != nil {
+		// The connection may be part way through a reply
+		cn.nc.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return replies, nil
+}
+
+func (cn *conn) pipeline(ctx context.Context, cmds [][]interface{}) ([]interface{}, error) {
+	deadline, _ := ctx.Deadline()
+	if err := cn.nc.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	for _, args := range cmds {
+		if err := writeCommand(cn.w, args); err != nil {
+			return nil, err
+		}
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(cmds))
+	for i := range replies {
+		r, err := readReply(cn.r)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = r
+	}
+	return replies, nil
+}
+
+// get takes an idle connection, or dials a new one
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{nc: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	var setup [][]interface{}
+	if c.password != "" {
+		setup = append(setup, []interface{}{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []interface{}{"SELECT", c.db})
+	}
+	if len(setup) > 0 {
+		replies, err := cn.pipeline(ctx, setup)
+		if err == nil {
+			for _, r := range replies {
+				if e, ok := r.(Error); ok {
+					err = e
+				}
+			}
+		}
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// put returns a healthy connection to the pool
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.idle) >= maxIdle {
+		cn.nc.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// Ping checks the server is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Get returns the value of key, or ErrNil if it doesn't exist
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	r, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, ErrNil
+	}
+	b, ok := r.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %T to GET", r)
+	}
+	return b, nil
+}
+
+// Set sets key to value, expiring after ttl unless it is 0
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []interface{}{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", int64(ttl/time.Millisecond))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del deletes keys, returning how many existed
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	args := []interface{}{"DEL"}
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	return c.integer(c.Do(ctx, args...))
+}
+
+// IncrBy adds n to the integer at key, starting from 0, returning the result
+func (c *Client) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return c.integer(c.Do(ctx, "INCRBY", key, n))
+}
+
+// ZAdd sets member's score in the sorted set at key
+func (c *Client) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	_, err := c.Do(ctx, "ZADD", key, score, member)
+	return err
+}
+
+// ZRangeByScore returns the members of the sorted set at key scoring
+// between min and max inclusive, lowest first
+func (c *Client) ZRangeByScore(ctx context.Context, key string, min, max float64) ([]string, error) {
+	r, err := c.Do(ctx, "ZRANGEBYSCORE", key, min, max)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := r.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %T to ZRANGEBYSCORE", r)
+	}
+	members := make([]string, 0, len(a))
+	for _, m := range a {
+		b, ok := m.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("redis: unexpected member %T", m)
+		}
+		members = append(members, string(b))
+	}
+	return members, nil
+}
+
+// ZRem removes member from the sorted set at key, returning 1 if it was
+// there and 0 if not
+func (c *Client) ZRem(ctx context.Context, key string, member string) (int64, error) {
+	return c.integer(c.Do(ctx, "ZREM", key, member))
+}
+
+// integer converts an integer reply
+func (c *Client) integer(r interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch r := r.(type) {
+	case int64:
+		return r, nil
+	case []byte:
+		return strconv.ParseInt(string(r), 10, 64)
+	default:
+		return 0, fmt.Errorf("redis: unexpected reply %T, want an integer", r)
+	}
+}
@@ -0,0 +1,222 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestClient starts a Fake and returns a Client for it
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	f, err := NewFake()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(f.Addr(), "secret", 2, time.Second)
+	t.Cleanup(func() {
+		c.Close()
+		f.Close()
+	})
+	return c
+}
+
+func TestClientStrings(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if _, err := c.Get(ctx, "k"); err != ErrNil {
+		t.Errorf("Get of a missing key = %v, want ErrNil", err)
+	}
+	if err := c.Set(ctx, "k", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := c.Get(ctx, "k"); err != nil || string(b) != "v" {
+		t.Errorf("Get = %q, %v, want v", b, err)
+	}
+	if n, err := c.Del(ctx, "k", "missing"); err != nil || n != 1 {
+		t.Errorf("Del = %d, %v, want 1", n, err)
+	}
+	if _, err := c.Get(ctx, "k"); err != ErrNil {
+		t.Errorf("Get after Del = %v, want ErrNil", err)
+	}
+}
+
+func TestClientSetTTL(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	if err := c.Set(ctx, "k", []byte("v"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "k"); err != nil {
+		t.Fatalf("Get before expiry: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := c.Get(ctx, "k"); err != ErrNil {
+		t.Errorf("Get after expiry = %v, want ErrNil", err)
+	}
+}
+
+func TestClientIncrBy(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	for _, step := range []struct{ by, want int64 }{{1, 1}, {5, 6}, {-7, -1}} {
+		n, err := c.IncrBy(ctx, "n", step.by)
+		if err != nil || n != step.want {
+			t.Errorf("IncrBy(%d) = %d, %v, want %d", step.by, n, err, step.want)
+		}
+	}
+
+	c.Set(ctx, "s", []byte("text"), 0)
+	if _, err := c.IncrBy(ctx, "s", 1); err == nil {
+		t.Error("IncrBy of a non-integer succeeded")
+	} else if _, ok := err.(Error); !ok {
+		t.Errorf("IncrBy of a non-integer = %T %v, want an Error", err, err)
+	}
+}
+
+func TestClientSortedSet(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	for i, m := range []string{"a", "b", "c"} {
+		if err := c.ZAdd(ctx, "z", float64(i+1), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := c.ZRangeByScore(ctx, "z", 2, 3)
+	if err != nil || !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("ZRangeByScore(2, 3) = %v, %v, want [b c]", got, err)
+	}
+
+	if n, err := c.ZRem(ctx, "z", "b"); err != nil || n != 1 {
+		t.Errorf("ZRem(b) = %d, %v, want 1", n, err)
+	}
+	if n, err := c.ZRem(ctx, "z", "b"); err != nil || n != 0 {
+		t.Errorf("ZRem(b) again = %d, %v, want 0", n, err)
+	}
+	got, err = c.ZRangeByScore(ctx, "z", 0, 10)
+	if err != nil || !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Errorf("ZRangeByScore after ZRem = %v, %v, want [a c]", got, err)
+	}
+
+	c.Set(ctx, "s", []byte("text"), 0)
+	if err := c.ZAdd(ctx, "s", 1, "a"); err == nil {
+		t.Error("ZAdd to a string succeeded")
+	}
+}
+
+func TestClientPipeline(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	replies, err := c.Pipeline(ctx,
+		[]interface{}{"INCR", "n"},
+		[]interface{}{"NOSUCHCOMMAND"},
+		[]interface{}{"INCR", "n"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 3 || replies[0] != int64(1) || replies[2] != int64(2) {
+		t.Errorf("Pipeline = %#v, want 1, an error and 2", replies)
+	}
+	if _, ok := replies[1].(Error); !ok {
+		t.Errorf("unknown command reply = %#v, want an Error", replies[1])
+	}
+
+	if _, err := c.Do(ctx, "NOSUCHCOMMAND"); err == nil {
+		t.Error("Do of an unknown command succeeded")
+	}
+}
+
+func TestClientConcurrent(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	const workers, each = 20, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				if _, err := c.IncrBy(ctx, "n", 1); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	b, err := c.Get(ctx, "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := strconv.Atoi(string(b)); n != workers*each {
+		t.Errorf("n = %d, want %d", n, workers*each)
+	}
+}
+
+func TestClientUnreachable(t *testing.T) {
+	f, err := NewFake()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := f.Addr()
+	f.Close()
+
+	c := New(addr, "", 0, time.Second)
+	if err := c.Ping(context.Background()); err == nil {
+		t.Error("Ping of a closed server succeeded")
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	// A server that accepts connections but never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer nc.Close()
+		}
+	}()
+
+	c := New(ln.Addr().String(), "", 0, 50*time.Millisecond)
+	start := time.Now()
+	err = c.Ping(context.Background())
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("Ping of a stalled server = %v, want a timeout", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Ping took %v to time out", d)
+	}
+
+	// A longer deadline from the caller doesn't extend the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	start = time.Now()
+	if err := c.Ping(ctx); err == nil {
+		t.Error("Ping of a stalled server succeeded")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Ping with a minute's deadline took %v to time out", d)
+	}
+}
@@ -0,0 +1,88 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReplyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply interface{}
+		wire  string
+	}{
+		{"simple string", "OK", "+OK\r\n"},
+		{"error", Error("ERR nope"), "-ERR nope\r\n"},
+		{"integer", int64(-42), ":-42\r\n"},
+		{"bulk string", []byte("hi\r\nthere"), "$9\r\nhi\r\nthere\r\n"},
+		{"empty bulk string", []byte{}, "$0\r\n\r\n"},
+		{"null", nil, "$-1\r\n"},
+		{"array", []interface{}{[]byte("a"), int64(1), nil}, "*3\r\n$1\r\na\r\n:1\r\n$-1\r\n"},
+		{"empty array", []interface{}{}, "*0\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+			writeReply(w, tt.reply)
+			w.Flush()
+			if buf.String() != tt.wire {
+				t.Errorf("writeReply(%#v) = %q, want %q", tt.reply, buf.String(), tt.wire)
+			}
+
+			got, err := readReply(bufio.NewReader(strings.NewReader(tt.wire)))
+			if err != nil {
+				t.Fatalf("readReply(%q): %v", tt.wire, err)
+			}
+			if !reflect.DeepEqual(got, tt.reply) {
+				t.Errorf("readReply(%q) = %#v, want %#v", tt.wire, got, tt.reply)
+			}
+		})
+	}
+}
+
+func TestReadNullArray(t *testing.T) {
+	got, err := readReply(bufio.NewReader(strings.NewReader("*-1\r\n")))
+	if err != nil || got != nil {
+		t.Errorf("readReply(*-1) = %#v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestReadReplyErrors(t *testing.T) {
+	for _, wire := range []string{
+		"\r\n",
+		"?what\r\n",
+		"+no crlf\n",
+		"$abc\r\n",
+		"$-2\r\n",
+		"*x\r\n",
+		":1.5\r\n",
+		"$5\r\nab",
+		"*2\r\n:1\r\n",
+	} {
+		if got, err := readReply(bufio.NewReader(strings.NewReader(wire))); err == nil {
+			t.Errorf("readReply(%q) = %#v, want an error", wire, got)
+		}
+	}
+}
+
+func TestWriteCommand(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	err := writeCommand(w, []interface{}{"SET", []byte("k"), 7, int64(-8), 1.5})
+	w.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "*5\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\n7\r\n$2\r\n-8\r\n$3\r\n1.5\r\n"
+	if buf.String() != want {
+		t.Errorf("writeCommand wrote %q, want %q", buf.String(), want)
+	}
+
+	if err := writeCommand(bufio.NewWriter(&buf), []interface{}{"GET", struct{}{}}); err == nil {
+		t.Error("writeCommand accepted a struct")
+	}
+}
@@ -0,0 +1,101 @@
+package slugs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Filter decides whether a slug contains words that shouldn't appear in
+// short urls, such as profanity or the names of brands that could be
+// impersonated
+type Filter interface {
+	Blocked(slug string) bool
+}
+
+// WordList is a Filter that blocks slugs containing any of a list of words.
+// Matching ignores case, separators like - and _, and common leetspeak
+// substitutions, so "b4d-w0rd" is caught by "badword".
+type WordList struct {
+	words []string // skeletons of the blocked words
+}
+
+// NewWordList creates a WordList blocking the given words
+func NewWordList(words []string) *WordList {
+	wl := &WordList{}
+	for _, w := range words {
+		if s := skeleton(w); s != "" {
+			wl.words = append(wl.words, s)
+		}
+	}
+	return wl
+}
+
+// LoadWordList reads a WordList from a file with one word per line. Blank
+// lines and lines starting with # are ignored.
+func LoadWordList(path string) (*WordList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading %v: %v", path, err)
+	}
+	return NewWordList(words), nil
+}
+
+// Len returns the number of blocked words
+func (wl *WordList) Len() int {
+	return len(wl.words)
+}
+
+// Blocked reports whether slug contains any of the words
+func (wl *WordList) Blocked(slug string) bool {
+	s := skeleton(slug)
+	for _, w := range wl.words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// leet maps characters to the letter they commonly stand in for. l and 1
+// both become i, as 1 is used for either and they look alike anyway.
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i', 'l': 'i', '!': 'i', '|': 'i',
+	'3': 'e',
+	'4': 'a', '@': 'a',
+	'5': 's', '$': 's',
+	'6': 'g', '9': 'g',
+	'7': 't', '+': 't',
+	'8': 'b',
+}
+
+// skeleton reduces s to the form words are matched in: lower case, leetspeak
+// replaced with letters, and anything else that isn't a letter dropped
+func skeleton(s string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(s) {
+		if r, ok := leet[c]; ok {
+			c = r
+		}
+		if c >= 'a' && c <= 'z' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
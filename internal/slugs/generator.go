@@ -0,0 +1,97 @@
+package slugs
+
+import (
+	"errors"
+	"sync"
+)
+
+// MaxLength is the longest slug the datastore can hold
+const MaxLength = 50
+
+const (
+	// maxAttempts bounds how many slugs are tried for a single url
+	maxAttempts = 10
+
+	// growAfter is how many collisions in a row at one length are taken to
+	// mean slugs of that length are getting used up
+	growAfter = 3
+
+	// maxRejections bounds how many unusable slugs are drawn for a single
+	// url. They are redrawn without counting as collisions, as they say
+	// nothing about how many slugs are in use.
+	maxRejections = 100
+)
+
+// ErrExhausted is returned when no free slug was found in maxAttempts tries
+var ErrExhausted = errors.New("slugs: no free slug found")
+
+// Generator creates random slugs, retrying on collisions. When collisions
+// show that slugs of the current length are getting scarce it moves on to
+// longer ones, and keeps using the longer length from then on. It is safe
+// for concurrent use.
+type Generator struct {
+	alphabet Alphabet
+
+	mu     sync.Mutex
+	length int
+}
+
+// NewGenerator creates a Generator of slugs from the given alphabet,
+// starting with slugs of the given length
+func NewGenerator(alphabet Alphabet, length int) *Generator {
+	return &Generator{alphabet: alphabet, length: length}
+}
+
+// Length returns the length of slug that will be tried first
+func (g *Generator) Length() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.length
+}
+
+// Generate calls save with random slugs until one is saved, returning it.
+// Slugs for which usable, if not nil, returns false are skipped without
+// calling save. save reports whether the slug was already taken; any error
+// from it stops generation and is returned.
+func (g *Generator) Generate(usable func(slug string) bool, save func(slug string) (taken bool, err error)) (string, error) {
+	length := g.Length()
+	collisions, rejections := 0, 0
+
+	for i := 0; i < maxAttempts; {
+		slug := g.alphabet.Random(length)
+		if usable != nil && !usable(slug) {
+			rejections++
+			if rejections >= maxRejections {
+				break
+			}
+			continue
+		}
+
+		i++
+		taken, err := save(slug)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return slug, nil
+		}
+
+		collisions++
+		if collisions >= growAfter && length < MaxLength {
+			length++
+			collisions = 0
+			g.grow(length)
+		}
+	}
+	return "", ErrExhausted
+}
+
+// grow raises the length used for future slugs, unless another caller has
+// already raised it further
+func (g *Generator) grow(length int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if length > g.length {
+		g.length = length
+	}
+}
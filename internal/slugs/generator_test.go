@@ -0,0 +1,67 @@
+package slugs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	failed := errors.New("save failed")
+	tests := []struct {
+		name       string
+		usable     func(string) bool
+		taken      int // saves reporting taken before one succeeds
+		err        error
+		wantErr    error
+		wantLength int // of the generator afterwards
+		wantSaves  int
+	}{
+		{name: "free", wantLength: 4, wantSaves: 1},
+		{name: "a collision", taken: 2, wantLength: 4, wantSaves: 3},
+		{name: "collisions grow", taken: 3, wantLength: 5, wantSaves: 4},
+		{name: "exhausted", taken: maxAttempts, wantErr: ErrExhausted, wantLength: 7, wantSaves: maxAttempts},
+		{name: "save error", err: failed, wantErr: failed, wantLength: 4, wantSaves: 1},
+		{
+			// Unusable slugs are redrawn without growing or being saved
+			name:       "mostly unusable",
+			usable:     func(slug string) bool { return strings.HasPrefix(slug, "a") },
+			wantLength: 4,
+			wantSaves:  1,
+		},
+		{
+			name:       "never usable",
+			usable:     func(string) bool { return false },
+			wantErr:    ErrExhausted,
+			wantLength: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGenerator(Alphabet{"abcd"}, 4)
+			saves := 0
+			slug, err := g.Generate(tt.usable, func(slug string) (bool, error) {
+				saves++
+				if tt.usable != nil && !tt.usable(slug) {
+					t.Errorf("saved unusable slug %q", slug)
+				}
+				if tt.err != nil {
+					return false, tt.err
+				}
+				return saves <= tt.taken, nil
+			})
+			if err != tt.wantErr {
+				t.Errorf("Generate = %q, %v, want error %v", slug, err, tt.wantErr)
+			}
+			if err == nil && len(slug) != tt.wantLength {
+				t.Errorf("Generate = %q, want length %d", slug, tt.wantLength)
+			}
+			if saves != tt.wantSaves {
+				t.Errorf("save called %d times, want %d", saves, tt.wantSaves)
+			}
+			if g.Length() != tt.wantLength {
+				t.Errorf("Length = %d after, want %d", g.Length(), tt.wantLength)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package slugs
+
+import (
+	"errors"
+	"strings"
+)
+
+// IDEncoder turns url ids into short slugs, in the style of hashids. Ids
+// are written in the base of the alphabet, so slugs are as short as
+// possible and distinct ids never share a slug, but the alphabet is
+// shuffled using a secret key, so consecutive ids don't give similar slugs.
+//
+// This hides how many urls there are from casual inspection; it is not
+// encryption, and someone who collects enough slugs could work out the
+// shuffle.
+type IDEncoder struct {
+	alphabet []byte // shuffled by the key
+	key      string
+}
+
+// NewIDEncoder creates an IDEncoder writing slugs with the characters of
+// alphabet, shuffled using key. The same alphabet and key must always be
+// used, or slugs for new ids may clash with existing ones.
+func NewIDEncoder(alphabet Alphabet, key string) (*IDEncoder, error) {
+	if key == "" {
+		return nil, errors.New("slugs: an id encoder needs a key")
+	}
+	a := []byte(alphabet.chars)
+	shuffle(a, key)
+	return &IDEncoder{alphabet: a, key: key}, nil
+}
+
+// Encode returns the slug for id, which must not be negative
+func (e *IDEncoder) Encode(id int) string {
+	if id < 0 {
+		panic("slugs: negative id")
+	}
+
+	// The first character, picked by the id, reshuffles the alphabet used
+	// for the rest so neighbouring ids look unrelated
+	base := uint64(len(e.alphabet))
+	lottery := e.alphabet[uint64(id)%base]
+	digits := e.digits(lottery)
+
+	var b []byte
+	for n := uint64(id); ; n /= base {
+		b = append(b, digits[n%base])
+		if n < base {
+			break
+		}
+	}
+	b = append(b, lottery)
+
+	// Digits were written least significant first
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+// Decode returns the id a slug was made from. ok is false if the slug could
+// not have come from Encode.
+func (e *IDEncoder) Decode(slug string) (id int, ok bool) {
+	if len(slug) < 2 || strings.IndexByte(string(e.alphabet), slug[0]) < 0 {
+		return 0, false
+	}
+
+	base := uint64(len(e.alphabet))
+	digits := string(e.digits(slug[0]))
+	maxID := uint64(int(^uint(0) >> 1))
+
+	var n uint64
+	for i := 1; i < len(slug); i++ {
+		d := strings.IndexByte(digits, slug[i])
+		if d < 0 || n > (maxID-uint64(d))/base {
+			return 0, false
+		}
+		n = n*base + uint64(d)
+	}
+
+	// Only the slug Encode produces counts, ruling out leading zeros and
+	// the wrong first character
+	if e.Encode(int(n)) != slug {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// digits returns the alphabet used for the digits of a slug starting with
+// lottery
+func (e *IDEncoder) digits(lottery byte) []byte {
+	d := make([]byte, len(e.alphabet))
+	copy(d, e.alphabet)
+	shuffle(d, string(lottery)+e.key)
+	return d
+}
+
+// shuffle reorders a in place, always the same way for the same salt. It is
+// the consistent shuffle used by hashids.
+func shuffle(a []byte, salt string) {
+	if salt == "" {
+		return
+	}
+	for i, v, p := len(a)-1, 0, 0; i > 0; i-- {
+		v %= len(salt)
+		n := int(salt[v])
+		p += n
+		j := (n + v + p) % i
+		a[i], a[j] = a[j], a[i]
+		v++
+	}
+}
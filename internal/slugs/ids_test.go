@@ -0,0 +1,150 @@
+package slugs
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestEncoder(t *testing.T, alphabet Alphabet, key string) *IDEncoder {
+	t.Helper()
+	e, err := NewIDEncoder(alphabet, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestIDEncoderRoundTrip(t *testing.T) {
+	maxID := int(^uint(0) >> 1)
+	tests := []struct {
+		name     string
+		alphabet Alphabet
+		key      string
+	}{
+		{"alphanumeric", Alphanumeric, "a secret key"},
+		{"unambiguous", Unambiguous, "another key"},
+		{"lowercase", Lowercase, "k"},
+		{"binary", Alphabet{"xy"}, "a secret key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEncoder(t, tt.alphabet, tt.key)
+			seen := make(map[string]int)
+			check := func(id int) {
+				slug := e.Encode(id)
+				for _, c := range slug {
+					if !strings.ContainsRune(tt.alphabet.chars, c) {
+						t.Fatalf("Encode(%d) = %q, which is outside the alphabet", id, slug)
+					}
+				}
+				if got, ok := e.Decode(slug); !ok || got != id {
+					t.Fatalf("Decode(Encode(%d) = %q) = %d, %v", id, slug, got, ok)
+				}
+				if other, dup := seen[slug]; dup {
+					t.Fatalf("Encode(%d) and Encode(%d) are both %q", other, id, slug)
+				}
+				seen[slug] = id
+			}
+			for id := 0; id < 5000; id++ {
+				check(id)
+			}
+			for _, id := range []int{1 << 31, 1<<31 - 1, maxID - 1, maxID} {
+				check(id)
+			}
+		})
+	}
+}
+
+func TestIDEncoderKeys(t *testing.T) {
+	a := newTestEncoder(t, Alphanumeric, "first key")
+	b := newTestEncoder(t, Alphanumeric, "second key")
+	again := newTestEncoder(t, Alphanumeric, "first key")
+
+	same := 0
+	for id := 0; id < 1000; id++ {
+		if a.Encode(id) != again.Encode(id) {
+			t.Fatalf("Encode(%d) differs between encoders with the same key", id)
+		}
+		if a.Encode(id) == b.Encode(id) {
+			same++
+		}
+	}
+	// A few may agree by chance, but not most
+	if same > 50 {
+		t.Errorf("%d of 1000 slugs are the same under different keys", same)
+	}
+
+	// Neighbouring ids shouldn't give neighbouring slugs
+	if a.Encode(1000)[1:] == a.Encode(1001)[1:] {
+		t.Errorf("Encode(1000) = %q and Encode(1001) = %q only differ in the first character", a.Encode(1000), a.Encode(1001))
+	}
+
+	if _, err := NewIDEncoder(Alphanumeric, ""); err == nil {
+		t.Error("NewIDEncoder without a key succeeded")
+	}
+}
+
+func TestIDEncoderDecodeInvalid(t *testing.T) {
+	e := newTestEncoder(t, Lowercase, "a secret key")
+	maxID := int(^uint(0) >> 1)
+
+	// Slugs Encode gives with another character first, or an extra zero
+	// digit, decode to the same number but aren't canonical
+	slug := e.Encode(1234)
+	lottery := slug[0]
+	zero := e.digits(lottery)[0]
+	other := e.alphabet[(strings.IndexByte(string(e.alphabet), lottery)+1)%len(e.alphabet)]
+
+	tests := []struct {
+		name, slug string
+	}{
+		{"empty", ""},
+		{"one character", slug[:1]},
+		{"outside the alphabet", "A" + slug[1:]},
+		{"digit outside the alphabet", slug[:1] + "-" + slug[2:]},
+		{"leading zero", string(lottery) + string(zero) + slug[1:]},
+		{"wrong first character", string(other) + slug[1:]},
+		{"overflowing", e.Encode(maxID) + string(e.digits(e.Encode(maxID)[0])[1])},
+		{"long", string(lottery) + strings.Repeat(string(e.digits(lottery)[1]), 40)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if id, ok := e.Decode(tt.slug); ok {
+				t.Errorf("Decode(%q) = %d, want it refused", tt.slug, id)
+			}
+		})
+	}
+}
+
+func TestIDEncoderDecodeExhaustive(t *testing.T) {
+	// Every short slug decodes exactly when Encode would produce it, so
+	// reserving decodable slugs reserves exactly the generated ones
+	e := newTestEncoder(t, Alphabet{"abcdef"}, "a secret key")
+	chars := e.alphabet
+
+	valid := 0
+	var walk func(prefix string)
+	walk = func(prefix string) {
+		if len(prefix) >= 2 {
+			id, ok := e.Decode(prefix)
+			if ok {
+				valid++
+				if e.Encode(id) != prefix {
+					t.Errorf("Decode(%q) = %d, but Encode(%d) = %q", prefix, id, id, e.Encode(id))
+				}
+			}
+		}
+		if len(prefix) == 4 {
+			return
+		}
+		for _, c := range chars {
+			walk(prefix + string(c))
+		}
+	}
+	walk("")
+
+	// Ids 0 to 6^3-1 have slugs of 2 to 4 characters
+	if want := 6 * 6 * 6; valid != want {
+		t.Errorf("%d slugs of up to 4 characters decode, want %d", valid, want)
+	}
+}
@@ -1,27 +1,106 @@
 package slugs
 
 import (
-	"math/rand"
+	"crypto/rand"
+	"fmt"
 	"strings"
-	"time"
 )
 
+// Alphabet is the set of characters slugs are made from
+type Alphabet struct {
+	chars string
+}
+
+// Built in alphabets
 var (
-	chars    []string
-	numChars int
+	// Alphanumeric is upper and lower case letters and digits
+	Alphanumeric = Alphabet{"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"}
+
+	// Unambiguous leaves out characters that are easily mistaken for one
+	// another, like 0 and O or 1, l and I, for slugs that are read aloud or
+	// typed from print
+	Unambiguous = Alphabet{"ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz23456789"}
+
+	// Lowercase is lower case letters and digits, for slugs that must
+	// survive being case folded
+	Lowercase = Alphabet{"abcdefghijklmnopqrstuvwxyz0123456789"}
 )
 
-func init() {
-	chars = []string{"A", "a", "B", "b", "C", "c", "D", "d", "E", "e", "F", "f", "G", "g", "H", "h", "I", "i", "J", "j", "K", "k", "L", "l", "M", "m", "N", "n", "O", "o", "P", "p", "Q", "q", "R", "r", "S", "s", "T", "t", "U", "u", "V", "v", "W", "w", "X", "x", "Y", "y", "Z", "z", "0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}
-	numChars = len(chars)
-	rand.Seed(time.Now().UnixNano())
+// alphabets are the built in alphabets by name
+var alphabets = map[string]Alphabet{
+	"alphanumeric": Alphanumeric,
+	"unambiguous":  Unambiguous,
+	"lowercase":    Lowercase,
 }
 
-// Random returns a random slug of length n
-func Random(n int) string {
-	var b strings.Builder
-	for i := 0; i < n; i++ {
-		b.WriteString(chars[rand.Intn(numChars)])
+// urlSafe are the characters allowed in a custom alphabet: those that never
+// need escaping in a url path
+const urlSafe = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~"
+
+// Named returns the built in alphabet with the given name
+func Named(name string) (Alphabet, error) {
+	a, ok := alphabets[name]
+	if !ok {
+		return Alphabet{}, fmt.Errorf("unknown slug alphabet %q, want alphanumeric, unambiguous or lowercase", name)
+	}
+	return a, nil
+}
+
+// NewAlphabet creates a custom alphabet. It needs at least two distinct
+// characters, all of which must be safe to use unescaped in a url.
+func NewAlphabet(chars string) (Alphabet, error) {
+	if len(chars) < 2 {
+		return Alphabet{}, fmt.Errorf("slug alphabet %q needs at least 2 characters", chars)
+	}
+	if len(chars) > 256 {
+		return Alphabet{}, fmt.Errorf("slug alphabet has more than 256 characters")
 	}
-	return b.String()
+	for i, c := range chars {
+		if !strings.ContainsRune(urlSafe, c) {
+			return Alphabet{}, fmt.Errorf("slug alphabet contains %q, only letters, digits and -._~ are allowed", c)
+		}
+		if strings.ContainsRune(chars[:i], c) {
+			return Alphabet{}, fmt.Errorf("slug alphabet contains %q more than once", c)
+		}
+	}
+	return Alphabet{chars}, nil
+}
+
+// String returns the characters in the alphabet
+func (a Alphabet) String() string {
+	return a.chars
+}
+
+// Random returns a random slug of length n made from the alphabet's
+// characters, each equally likely. Randomness comes from crypto/rand, so
+// slugs can't be predicted from earlier ones.
+func (a Alphabet) Random(n int) string {
+	// Bytes at or above limit are discarded so every character is equally
+	// likely, rather than favouring those at the start of the alphabet
+	size := len(a.chars)
+	limit := 256 - 256%size
+
+	slug := make([]byte, 0, n)
+	buf := make([]byte, n+n/2)
+	for len(slug) < n {
+		if _, err := rand.Read(buf); err != nil {
+			// crypto/rand doesn't fail on supported platforms
+			panic(fmt.Sprintf("slugs: reading random bytes: %v", err))
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			slug = append(slug, a.chars[int(b)%size])
+			if len(slug) == n {
+				break
+			}
+		}
+	}
+	return string(slug)
+}
+
+// Random returns a random alphanumeric slug of length n
+func Random(n int) string {
+	return Alphanumeric.Random(n)
 }
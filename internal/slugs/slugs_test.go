@@ -0,0 +1,149 @@
+package slugs
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRandom(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet Alphabet
+		length   int
+	}{
+		{"alphanumeric", Alphanumeric, 6},
+		{"unambiguous", Unambiguous, 8},
+		{"lowercase", Lowercase, 1},
+		{"binary", Alphabet{"01"}, 40},
+		{"url safe", Alphabet{urlSafe}, 12},
+		{"empty", Alphanumeric, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				slug := tt.alphabet.Random(tt.length)
+				if len(slug) != tt.length {
+					t.Fatalf("Random(%d) = %q", tt.length, slug)
+				}
+				for _, c := range slug {
+					if !strings.ContainsRune(tt.alphabet.chars, c) {
+						t.Fatalf("Random(%d) = %q, which is outside the alphabet", tt.length, slug)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRandomUniform(t *testing.T) {
+	// Alphabets whose size doesn't divide 256, so taking random bytes
+	// modulo the size would favour the first characters
+	tests := []struct {
+		name     string
+		alphabet Alphabet
+	}{
+		{"alphanumeric", Alphanumeric},
+		{"unambiguous", Unambiguous},
+		{"lowercase", Lowercase},
+		{"three", Alphabet{"abc"}},
+		{"url safe", Alphabet{urlSafe}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size := len(tt.alphabet.chars)
+			const each = 2000
+			counts := make(map[rune]int)
+			for _, c := range tt.alphabet.Random(size * each) {
+				counts[c]++
+			}
+
+			// A chi-squared statistic more than 6 standard deviations above
+			// its mean is vanishingly unlikely from uniform characters; the
+			// bias from a plain modulo is well past it
+			var chi2 float64
+			for _, c := range tt.alphabet.chars {
+				d := float64(counts[c] - each)
+				chi2 += d * d / each
+			}
+			dof := float64(size - 1)
+			if limit := dof + 6*math.Sqrt(2*dof); chi2 > limit {
+				t.Errorf("characters aren't uniform: chi-squared %.1f over %.1f, counts %v", chi2, limit, counts)
+			}
+		})
+	}
+}
+
+func TestNewAlphabet(t *testing.T) {
+	tests := []struct {
+		chars string
+		ok    bool
+	}{
+		{"ab", true},
+		{"abcdef0123", true},
+		{urlSafe, true},
+		{"", false},
+		{"a", false},
+		{"aba", false},
+		{"ab/", false},
+		{"ab%", false},
+		{"abé", false},
+		{"ab c", false},
+	}
+	for _, tt := range tests {
+		a, err := NewAlphabet(tt.chars)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewAlphabet(%q) = %v, want ok %v", tt.chars, err, tt.ok)
+		}
+		if err == nil && a.String() != tt.chars {
+			t.Errorf("NewAlphabet(%q) has characters %q", tt.chars, a.String())
+		}
+	}
+
+	for name, want := range alphabets {
+		if a, err := Named(name); err != nil || a != want {
+			t.Errorf("Named(%q) = %v, %v", name, a, err)
+		}
+	}
+	if _, err := Named("emoji"); err == nil {
+		t.Error("Named of an unknown alphabet succeeded")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	v := NewValidator(Alphanumeric.chars+"-_", 2, 10, []string{"info", "API"}, NewWordList([]string{"bad"}))
+	tests := []struct {
+		slug   string
+		ok     bool
+		reason Reason
+	}{
+		{"ab", true, 0},
+		{"my-link_1", true, 0},
+		{"a", false, Malformed},
+		{"abcdefghijk", false, Malformed},
+		{"has space", false, Malformed},
+		{"ümlaut", false, Malformed},
+		{"info", false, Reserved},
+		{"Info", false, Reserved},
+		{"api", false, Reserved},
+		{"notbad", false, Blocked},
+		{"B4D", false, Blocked},
+		{"b-a-d", false, Blocked},
+	}
+	for _, tt := range tests {
+		err := v.Validate(tt.slug)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("Validate(%q) = %v", tt.slug, err)
+			}
+			continue
+		}
+		r, ok := err.(*Rejection)
+		if !ok || r.Reason != tt.reason {
+			t.Errorf("Validate(%q) = %v, want reason %v", tt.slug, err, tt.reason)
+		}
+		if usable := v.Usable(tt.slug); usable != (tt.reason == Malformed) {
+			t.Errorf("Usable(%q) = %v", tt.slug, usable)
+		}
+	}
+}
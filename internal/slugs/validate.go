@@ -0,0 +1,88 @@
+package slugs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultReserved are slugs kept back whatever routes the server has, as
+// browsers and crawlers request them by name
+var DefaultReserved = []string{"favicon.ico", "robots.txt", ".well-known"}
+
+// Reason is why a slug was rejected
+type Reason int
+
+// Reasons for rejecting a slug
+const (
+	// Malformed slugs have the wrong characters or length
+	Malformed Reason = iota
+	// Reserved slugs are kept for the server's own use
+	Reserved
+	// Blocked slugs contain a word from the filter
+	Blocked
+)
+
+// Rejection explains why a requested slug isn't allowed
+type Rejection struct {
+	Reason  Reason
+	Message string
+}
+
+func (r *Rejection) Error() string {
+	return r.Message
+}
+
+// Validator checks slugs requested by users against a character set, a
+// length range, a list of reserved words and optionally a Filter
+type Validator struct {
+	chars     string
+	minLength int
+	maxLength int
+	reserved  map[string]bool
+	filter    Filter
+}
+
+// NewValidator creates a Validator allowing slugs of minLength to maxLength
+// characters from chars, other than those in reserved or blocked by filter,
+// which may be nil. Reserved words are matched ignoring case, so they can't
+// be imitated either.
+func NewValidator(chars string, minLength, maxLength int, reserved []string, filter Filter) *Validator {
+	v := &Validator{
+		chars:     chars,
+		minLength: minLength,
+		maxLength: maxLength,
+		reserved:  make(map[string]bool),
+		filter:    filter,
+	}
+	for _, r := range append(reserved, DefaultReserved...) {
+		v.reserved[strings.ToLower(r)] = true
+	}
+	return v
+}
+
+// Validate returns a *Rejection if slug isn't allowed
+func (v *Validator) Validate(slug string) error {
+	// Lengths are counted in characters, so multi-byte ones are caught by
+	// the character check rather than miscounted
+	if n := len([]rune(slug)); n < v.minLength || n > v.maxLength {
+		return &Rejection{Reason: Malformed, Message: fmt.Sprintf("Short urls must be %d to %d characters long.", v.minLength, v.maxLength)}
+	}
+	for _, c := range slug {
+		if !strings.ContainsRune(v.chars, c) {
+			return &Rejection{Reason: Malformed, Message: fmt.Sprintf("Short urls can't contain %q. Allowed characters are: %v", c, v.chars)}
+		}
+	}
+	if v.reserved[strings.ToLower(slug)] {
+		return &Rejection{Reason: Reserved, Message: fmt.Sprintf("The short url '%v' is reserved.", slug)}
+	}
+	if v.filter != nil && v.filter.Blocked(slug) {
+		return &Rejection{Reason: Blocked, Message: fmt.Sprintf("The short url '%v' is not allowed.", slug)}
+	}
+	return nil
+}
+
+// Usable reports whether a generated slug may be used, as it is neither
+// reserved nor blocked. Generated slugs only need these checks.
+func (v *Validator) Usable(slug string) bool {
+	return !v.reserved[strings.ToLower(slug)] && (v.filter == nil || !v.filter.Blocked(slug))
+}
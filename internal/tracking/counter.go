@@ -0,0 +1,171 @@
+package tracking
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+	"github.com/dabfleming/shorty/internal/redis"
+)
+
+// unknown fills in the details of visits that were counted but whose hits
+// were lost, for example dropped from a full queue
+const unknown = "Unknown"
+
+// Store is what a Counter needs from the datastore
+type Store interface {
+	Saver
+	CountVisits(ctx context.Context, urlID int) (int, error)
+}
+
+// Counter keeps each url's click count in Redis, shared by every instance,
+// so click limits can be checked without counting visits in the database.
+// The counts are reconciled into the visit table by Run.
+type Counter struct {
+	client  *redis.Client
+	store   Store
+	prefix  string
+	touched string // sorted set of url ids by when they were last clicked
+}
+
+// NewCounter returns a Counter keeping counts under keys starting with
+// prefix
+func NewCounter(client *redis.Client, store Store, prefix string) *Counter {
+	return &Counter{
+		client:  client,
+		store:   store,
+		prefix:  prefix,
+		touched: prefix + "touched",
+	}
+}
+
+// Click counts a click on a url, returning its clicks including this one.
+// A url without a count yet, perhaps because Redis lost it, starts from
+// the visits already saved.
+func (c *Counter) Click(ctx context.Context, urlID int) (int, error) {
+	replies, err := c.client.Pipeline(ctx,
+		[]interface{}{"INCR", c.key(urlID)},
+		[]interface{}{"ZADD", c.touched, float64(time.Now().Unix()), strconv.Itoa(urlID)},
+	)
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range replies {
+		if e, ok := r.(redis.Error); ok {
+			return 0, e
+		}
+	}
+	n, _ := replies[0].(int64)
+
+	if n == 1 {
+		saved, err := c.store.CountVisits(ctx, urlID)
+		if err != nil {
+			return 0, err
+		}
+		if saved > 0 {
+			if n, err = c.client.IncrBy(ctx, c.key(urlID), int64(saved)); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return int(n), nil
+}
+
+// Unclick takes back a click, for one that was refused because the url
+// had run out of clicks
+func (c *Counter) Unclick(ctx context.Context, urlID int) error {
+	_, err := c.client.IncrBy(ctx, c.key(urlID), -1)
+	return err
+}
+
+// Run reconciles counts with the visit table every interval until ctx is
+// done
+func (c *Counter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Reconcile(ctx, interval); err != nil {
+				log.Printf("Error reconciling click counts: %v", err)
+			}
+		}
+	}
+}
+
+// Reconcile brings the visit table and the counts of urls not clicked for
+// at least settle into line. Waiting lets queued hits be saved first, so
+// only clicks whose hits were lost are left over. Those are saved as
+// visits with unknown details; a count below the saved visits is raised.
+// When several instances reconcile at once, each url is reconciled only by
+// the one that removes it from the touched set.
+func (c *Counter) Reconcile(ctx context.Context, settle time.Duration) error {
+	ids, err := c.client.ZRangeByScore(ctx, c.touched, 0, float64(time.Now().Add(-settle).Unix()))
+	if err != nil {
+		return err
+	}
+
+	for _, member := range ids {
+		// Forget the url first, so a click from now on brings it back.
+		// If another instance got there first, it reconciles the url.
+		removed, err := c.client.ZRem(ctx, c.touched, member)
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			continue
+		}
+		urlID, err := strconv.Atoi(member)
+		if err != nil {
+			continue
+		}
+
+		b, err := c.client.Get(ctx, c.key(urlID))
+		if err == redis.ErrNil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		clicks, err := strconv.Atoi(string(b))
+		if err != nil {
+			continue
+		}
+		saved, err := c.store.CountVisits(ctx, urlID)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case clicks > saved:
+			now := time.Now()
+			hits := make([]datastore.Hit, clicks-saved)
+			for i := range hits {
+				hits[i] = datastore.Hit{URLID: urlID, Device: unknown, OS: unknown, Browser: unknown, IP: unknown, Time: now}
+			}
+			if err := c.store.TrackHits(ctx, hits); err != nil {
+				// Most likely the url has been purged since
+				log.Printf("Error saving %d lost visits to url %d, forgetting them: %v", len(hits), urlID, err)
+				if _, err := c.client.Del(ctx, c.key(urlID)); err != nil {
+					return err
+				}
+				continue
+			}
+			log.Printf("Saved %d lost visits to url %d", len(hits), urlID)
+		case clicks < saved:
+			if _, err := c.client.IncrBy(ctx, c.key(urlID), int64(saved-clicks)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Counter) key(urlID int) string {
+	return c.prefix + strconv.Itoa(urlID)
+}
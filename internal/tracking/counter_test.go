@@ -0,0 +1,349 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+	"github.com/dabfleming/shorty/internal/redis"
+)
+
+// newTestCounter returns a Counter backed by a fake Redis and a memory
+// datastore holding one url, whose id it also returns
+func newTestCounter(t *testing.T) (*Counter, datastore.Datastore, int) {
+	t.Helper()
+	f, err := redis.NewFake()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.New(f.Addr(), "", 0, time.Second)
+	t.Cleanup(func() {
+		client.Close()
+		f.Close()
+	})
+
+	ds := datastore.NewMemory()
+	u := &datastore.URLMap{Slug: "abc", URL: "https://example.com/"}
+	if err := ds.SaveNewURL(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	return NewCounter(client, ds, "clicks:"), ds, u.ID
+}
+
+// saveHits records n visits to a url
+func saveHits(t *testing.T, ds datastore.Datastore, urlID, n int) {
+	t.Helper()
+	hits := make([]datastore.Hit, n)
+	for i := range hits {
+		hits[i] = datastore.Hit{URLID: urlID, Device: "d", OS: "o", Browser: "b", IP: "127.0.0.1", Time: time.Now()}
+	}
+	if err := ds.TrackHits(context.Background(), hits); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countVisits(t *testing.T, ds datastore.Datastore, urlID int) int {
+	t.Helper()
+	n, err := ds.CountVisits(context.Background(), urlID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCounterClick(t *testing.T) {
+	ctx := context.Background()
+	c, ds, id := newTestCounter(t)
+
+	// A url without a count starts from its saved visits
+	saveHits(t, ds, id, 3)
+	for want := 4; want <= 6; want++ {
+		n, err := c.Click(ctx, id)
+		if err != nil || n != want {
+			t.Fatalf("Click = %d, %v, want %d", n, err, want)
+		}
+	}
+
+	if err := c.Unclick(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.Click(ctx, id); err != nil || n != 6 {
+		t.Errorf("Click after Unclick = %d, %v, want 6", n, err)
+	}
+}
+
+func TestCounterReconcileLostVisits(t *testing.T) {
+	ctx := context.Background()
+	c, ds, id := newTestCounter(t)
+
+	// Five clicks, of which only two were saved
+	for i := 0; i < 5; i++ {
+		if _, err := c.Click(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saveHits(t, ds, id, 2)
+
+	// Urls clicked too recently are left alone
+	if err := c.Reconcile(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if n := countVisits(t, ds, id); n != 2 {
+		t.Fatalf("visits after reconciling unsettled clicks = %d, want 2", n)
+	}
+
+	if err := c.Reconcile(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := countVisits(t, ds, id); n != 5 {
+		t.Errorf("visits after reconciling = %d, want 5", n)
+	}
+	_, visits, err := ds.GetVisits(ctx, "abc", datastore.AllURLs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknowns := 0
+	for _, v := range visits {
+		if v.Browser == unknown {
+			unknowns++
+		}
+	}
+	if unknowns != 3 {
+		t.Errorf("%d visits with unknown details, want 3", unknowns)
+	}
+
+	// Nothing is left to reconcile
+	if err := c.Reconcile(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := countVisits(t, ds, id); n != 5 {
+		t.Errorf("visits after reconciling again = %d, want 5", n)
+	}
+}
+
+func TestCounterReconcileRaisesCount(t *testing.T) {
+	ctx := context.Background()
+	c, ds, id := newTestCounter(t)
+
+	if _, err := c.Click(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	// Visits saved without being counted, say while Redis was down
+	saveHits(t, ds, id, 4)
+
+	if err := c.Reconcile(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := countVisits(t, ds, id); n != 4 {
+		t.Errorf("visits = %d, want 4", n)
+	}
+	if n, err := c.Click(ctx, id); err != nil || n != 5 {
+		t.Errorf("Click after reconciling = %d, %v, want 5", n, err)
+	}
+}
+
+func TestCounterReconcilePurgedURL(t *testing.T) {
+	ctx := context.Background()
+	c, ds, id := newTestCounter(t)
+
+	if _, err := c.Click(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.DeleteURL(ctx, "abc", datastore.PurgeVisits, datastore.AllURLs); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reconcile(ctx, 0); err != nil {
+		t.Fatalf("Reconcile of a purged url: %v", err)
+	}
+	if _, err := c.client.Get(ctx, c.key(id)); err != redis.ErrNil {
+		t.Errorf("count of a purged url = %v, want it deleted", err)
+	}
+}
+
+// gatedStore holds back the answers to CountVisits until every instance
+// has asked, or a moment has passed, so concurrent reconcilers all see the
+// count from before any of them saved visits
+type gatedStore struct {
+	Store
+	mu      sync.Mutex
+	waiting int
+	want    int
+	gate    chan struct{}
+}
+
+func newGatedStore(s Store, want int) *gatedStore {
+	g := &gatedStore{Store: s, want: want, gate: make(chan struct{})}
+	time.AfterFunc(100*time.Millisecond, g.open)
+	return g
+}
+
+func (g *gatedStore) open() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-g.gate:
+	default:
+		close(g.gate)
+	}
+}
+
+func (g *gatedStore) CountVisits(ctx context.Context, urlID int) (int, error) {
+	n, err := g.Store.CountVisits(ctx, urlID)
+	g.mu.Lock()
+	g.waiting++
+	full := g.waiting >= g.want
+	g.mu.Unlock()
+	if full {
+		g.open()
+	}
+	<-g.gate
+	return n, err
+}
+
+// stallProxy forwards connections to a Redis server, holding back ZREM
+// until want ZRANGEBYSCOREs have been sent or a moment has passed, so
+// concurrent reconcilers all read the touched set before any removes from
+// it
+type stallProxy struct {
+	ln     net.Listener
+	target string
+
+	mu     sync.Mutex
+	ranges int
+	want   int
+	ready  chan struct{}
+}
+
+func newStallProxy(t *testing.T, target string, want int) *stallProxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &stallProxy{ln: ln, target: target, want: want, ready: make(chan struct{})}
+	t.Cleanup(func() { ln.Close() })
+	time.AfterFunc(100*time.Millisecond, p.release)
+	go p.serve()
+	return p
+}
+
+func (p *stallProxy) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.ready:
+	default:
+		close(p.ready)
+	}
+}
+
+func (p *stallProxy) serve() {
+	for {
+		client, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		server, err := net.Dial("tcp", p.target)
+		if err != nil {
+			client.Close()
+			continue
+		}
+		go func() {
+			io.Copy(client, server)
+			client.Close()
+		}()
+		go func() {
+			p.forward(server, client)
+			server.Close()
+		}()
+	}
+}
+
+// forward copies commands to the server. The client flushes each command
+// in one write, so a read holds whole commands.
+func (p *stallProxy) forward(server, client net.Conn) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := client.Read(buf)
+		if err != nil {
+			return
+		}
+		chunk := buf[:n]
+		if bytes.Contains(chunk, []byte("ZRANGEBYSCORE")) {
+			p.mu.Lock()
+			p.ranges++
+			full := p.ranges >= p.want
+			p.mu.Unlock()
+			if full {
+				p.release()
+			}
+		}
+		if bytes.Contains(chunk, []byte("ZREM\r\n")) {
+			<-p.ready
+		}
+		if _, err := server.Write(chunk); err != nil {
+			return
+		}
+	}
+}
+
+// Several instances reconciling at once must save each lost visit once
+func TestCounterConcurrentReconcile(t *testing.T) {
+	ctx := context.Background()
+	f, err := redis.NewFake()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ds := datastore.NewMemory()
+
+	const instances, clicks = 4, 3
+	proxy := newStallProxy(t, f.Addr(), instances)
+	counters := make([]*Counter, instances)
+	for i := range counters {
+		client := redis.New(proxy.ln.Addr().String(), "", 0, time.Second)
+		defer client.Close()
+		counters[i] = NewCounter(client, ds, "clicks:")
+	}
+
+	u := &datastore.URLMap{Slug: "abc", URL: "https://example.com/"}
+	if err := ds.SaveNewURL(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < clicks; i++ {
+		if _, err := counters[0].Click(ctx, u.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Clicking seeded the counts; from now on every instance waits for
+	// the others before comparing counts
+	gated := newGatedStore(ds, instances)
+	for _, c := range counters {
+		c.store = gated
+	}
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, c := range counters {
+		wg.Add(1)
+		go func(c *Counter) {
+			defer wg.Done()
+			<-start
+			if err := c.Reconcile(ctx, 0); err != nil {
+				t.Error(err)
+			}
+		}(c)
+	}
+	close(start)
+	wg.Wait()
+
+	if n := countVisits(t, ds, u.ID); n != clicks {
+		t.Errorf("%d visits after reconciling concurrently, want %d", n, clicks)
+	}
+}
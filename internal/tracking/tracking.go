@@ -0,0 +1,183 @@
+// Package tracking records visits in the background, so redirects don't
+// wait on the database
+package tracking
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dabfleming/shorty/internal/datastore"
+)
+
+// Saver saves batches of hits; it is satisfied by every datastore.Datastore
+type Saver interface {
+	TrackHits(ctx context.Context, hits []datastore.Hit) error
+}
+
+// Options size the queue and control how often it is drained
+type Options struct {
+	// QueueSize is how many hits may wait to be saved. Hits arriving when
+	// the queue is full are dropped rather than slowing down redirects.
+	QueueSize int
+	// Workers is how many goroutines save hits
+	Workers int
+	// BatchSize is the most hits a worker saves in one insert
+	BatchSize int
+	// FlushInterval is the longest a hit waits before its batch is saved
+	FlushInterval time.Duration
+}
+
+// Stats count what has happened to hits so far
+type Stats struct {
+	Queued   int   `json:"queued"`
+	Capacity int   `json:"capacity"`
+	Recorded int64 `json:"recorded"`
+	Dropped  int64 `json:"dropped"`
+	Failed   int64 `json:"failed"`
+}
+
+// Recorder queues hits and saves them in batches. It is safe for
+// concurrent use.
+type Recorder struct {
+	saver Saver
+	opts  Options
+	queue chan datastore.Hit
+	wg    sync.WaitGroup
+
+	// mu guards closed, so nothing is sent on the queue once it is closed
+	mu     sync.RWMutex
+	closed bool
+
+	recorded atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+}
+
+// NewRecorder starts a Recorder saving hits to saver
+func NewRecorder(saver Saver, opts Options) *Recorder {
+	r := &Recorder{
+		saver: saver,
+		opts:  opts,
+		queue: make(chan datastore.Hit, opts.QueueSize),
+	}
+	r.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go r.work()
+	}
+	return r
+}
+
+// Record queues h to be saved, without waiting. It returns false if the
+// hit was dropped because the queue is full or the Recorder is closed.
+func (r *Recorder) Record(h datastore.Hit) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !r.closed {
+		select {
+		case r.queue <- h:
+			return true
+		default:
+		}
+	}
+
+	if n := r.dropped.Add(1); n == 1 || n%1000 == 0 {
+		log.Printf("Visit queue full, %d hits dropped so far", n)
+	}
+	return false
+}
+
+// Stats returns the Recorder's counters
+func (r *Recorder) Stats() Stats {
+	return Stats{
+		Queued:   len(r.queue),
+		Capacity: cap(r.queue),
+		Recorded: r.recorded.Load(),
+		Dropped:  r.dropped.Load(),
+		Failed:   r.failed.Load(),
+	}
+}
+
+// Close stops accepting hits and waits for those queued to be saved, or
+// for ctx to be done
+func (r *Recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// work saves hits from the queue whenever a batch fills up or the flush
+// interval passes, until the queue is closed and empty
+func (r *Recorder) work() {
+	defer r.wg.Done()
+
+	batch := make([]datastore.Hit, 0, r.opts.BatchSize)
+	ticker := time.NewTicker(r.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case h, ok := <-r.queue:
+			if !ok {
+				r.flush(batch)
+				return
+			}
+			batch = append(batch, h)
+			if len(batch) >= r.opts.BatchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush saves a batch. If that fails, perhaps because one hit's url has
+// since been purged, the hits are saved one at a time so the rest survive.
+func (r *Recorder) flush(batch []datastore.Hit) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	err := r.saver.TrackHits(ctx, batch)
+	if err == nil {
+		r.recorded.Add(int64(len(batch)))
+		return
+	}
+	if len(batch) == 1 {
+		r.failed.Add(1)
+		log.Printf("Error tracking hit: %v", err)
+		return
+	}
+
+	log.Printf("Error tracking %d hits, retrying one at a time: %v", len(batch), err)
+	for i := range batch {
+		if err := r.saver.TrackHits(ctx, batch[i:i+1]); err != nil {
+			r.failed.Add(1)
+			log.Printf("Error tracking hit: %v", err)
+			continue
+		}
+		r.recorded.Add(1)
+	}
+}
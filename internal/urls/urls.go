@@ -0,0 +1,254 @@
+// Package urls validates and normalizes the destinations of short urls
+package urls
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxLength is the longest url allowed, as the url.url column is varchar(4096)
+const MaxLength = 4096
+
+// Reason is why a url was rejected
+type Reason int
+
+// Reasons for rejecting a url
+const (
+	// Malformed urls can't be parsed, or aren't absolute http(s) urls
+	Malformed Reason = iota
+	// Private urls point at loopback, private or link-local addresses
+	Private
+)
+
+// Rejection explains why a url isn't allowed
+type Rejection struct {
+	Reason  Reason
+	Message string
+}
+
+func (r *Rejection) Error() string {
+	return r.Message
+}
+
+func malformed(format string, args ...interface{}) error {
+	return &Rejection{Reason: Malformed, Message: fmt.Sprintf(format, args...)}
+}
+
+// Validator checks and normalizes destination urls
+type Validator struct {
+	blockPrivate bool
+
+	// lookup resolves host names when private destinations are blocked
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// NewValidator creates a Validator. If blockPrivate is true, urls whose host
+// is or resolves to a loopback, private or link-local address are refused.
+func NewValidator(blockPrivate bool) *Validator {
+	return &Validator{
+		blockPrivate: blockPrivate,
+		lookup:       net.DefaultResolver.LookupIPAddr,
+	}
+}
+
+// Normalize checks raw is an absolute http or https url, returning it in a
+// normal form: the scheme and host lower cased, international host names
+// punycoded, any default port removed and an empty path made /. Problems
+// are returned as a *Rejection.
+func (v *Validator) Normalize(ctx context.Context, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", malformed("Must include a URL.")
+	}
+	if len(raw) > MaxLength {
+		return "", malformed("URLs must be at most %d characters long.", MaxLength)
+	}
+	for _, c := range raw {
+		if unicode.IsSpace(c) || unicode.IsControl(c) {
+			return "", malformed("URLs can't contain spaces or control characters.")
+		}
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", malformed("That doesn't look like a URL.")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", malformed("URL must begin with 'http://' or 'https://'.")
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", malformed("URL must include a host, like 'https://example.com/'.")
+	}
+	// https://trusted.example@evil.example/ goes to evil.example
+	if u.User != nil {
+		return "", malformed("URLs can't contain a username or password.")
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", malformed("Port %q is not valid.", port)
+		}
+	}
+	if port == "" || (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = host
+		if strings.Contains(host, ":") {
+			u.Host = "[" + host + "]"
+		}
+	} else {
+		u.Host = net.JoinHostPort(host, port)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+
+	if v.blockPrivate {
+		if err := v.checkPublic(ctx, host); err != nil {
+			return "", err
+		}
+	}
+
+	s := u.String()
+	if len(s) > MaxLength {
+		return "", malformed("URLs must be at most %d characters long.", MaxLength)
+	}
+	return s, nil
+}
+
+// NormalizeHost returns host as it appears in urls returned by Normalize,
+// for matching stored urls by host. IPv6 addresses may be given with or
+// without brackets.
+func NormalizeHost(host string) (string, error) {
+	host, err := normalizeHost(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return host, nil
+}
+
+// normalizeHost lower cases host and punycodes any international labels.
+// IP addresses are returned in their canonical form.
+func normalizeHost(host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	if strings.Contains(host, ":") {
+		return "", malformed("Host %q is not a valid address.", host)
+	}
+
+	// Browsers treat ideographic full stops as dots too
+	host = strings.NewReplacer("。", ".", "．", ".", "｡", ".").Replace(host)
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || len(host) > 253 {
+		return "", malformed("Host name is not valid.")
+	}
+
+	labels := strings.Split(host, ".")
+	for i, l := range labels {
+		if l == "" {
+			return "", malformed("Host %q is not valid.", host)
+		}
+		if !isASCII(l) {
+			p, err := punycode(l)
+			if err != nil {
+				return "", malformed("Host %q is not valid.", host)
+			}
+			l = "xn--" + p
+			labels[i] = l
+		}
+		if len(l) > 63 {
+			return "", malformed("Host %q is not valid.", host)
+		}
+		for _, c := range l {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return "", malformed("Host %q is not valid.", host)
+			}
+		}
+	}
+	// Browsers read hosts ending in a number, like 2130706433 or
+	// 127.1, as IPv4 addresses, so only allow the dotted form
+	last := labels[len(labels)-1]
+	if isNumeric(last) {
+		return "", malformed("Host %q is not valid; write IP addresses as four numbers, like 192.0.2.1.", host)
+	}
+
+	host = strings.Join(labels, ".")
+	if len(host) > 253 {
+		return "", malformed("Host name is not valid.")
+	}
+	return host, nil
+}
+
+// checkPublic refuses hosts that are, or resolve to, addresses that aren't
+// on the public internet. Hosts that can't be resolved are allowed, as the
+// name may simply not exist yet.
+func (v *Validator) checkPublic(ctx context.Context, host string) error {
+	private := &Rejection{Reason: Private, Message: fmt.Sprintf("URLs can't point at private or local addresses like %v.", host)}
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return private
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if isPrivate(ip) {
+			return private
+		}
+		return nil
+	}
+
+	addrs, err := v.lookup(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if isPrivate(a.IP) {
+			return private
+		}
+	}
+	return nil
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// isNumeric reports whether s is a decimal, octal or 0x hex number
+func isNumeric(s string) bool {
+	if strings.HasPrefix(s, "0x") {
+		s = s[2:]
+		for _, c := range s {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+				return false
+			}
+		}
+		return true
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}